@@ -2,6 +2,7 @@ package main
 
 import (
     "context"
+    "flag"
     "fmt"
     "log"
     "net/http"
@@ -13,8 +14,11 @@ import (
     "github.com/Sleepstars/SZU-NetManager/internal/config"
     "github.com/Sleepstars/SZU-NetManager/internal/db"
     "github.com/Sleepstars/SZU-NetManager/internal/api"
+    "github.com/Sleepstars/SZU-NetManager/internal/jobs"
     "github.com/Sleepstars/SZU-NetManager/internal/login"
     "github.com/Sleepstars/SZU-NetManager/internal/monitor"
+    "github.com/Sleepstars/SZU-NetManager/internal/secret"
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
     "github.com/Sleepstars/SZU-NetManager/internal/sshqueue"
     "github.com/Sleepstars/SZU-NetManager/internal/uci"
     "github.com/Sleepstars/SZU-NetManager/internal/httpmw"
@@ -23,6 +27,10 @@ import (
 
 func main() {
     cfg := config.Load()
+    if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+        rotateKey(cfg, os.Args[2:])
+        return
+    }
 
     // DB
     database, err := db.Open(cfg.DBPath)
@@ -34,6 +42,27 @@ func main() {
         log.Fatalf("migrate db: %v", err)
     }
 
+    // Master key for account passwords
+    box := loadBox(cfg)
+    accounts := service.NewAccounts(database, box)
+    if err := accounts.CheckKey(context.Background()); err != nil {
+        log.Fatalf("master key does not match stored passwords: %v", err)
+    }
+    if n, err := accounts.SealPlaintext(context.Background()); err != nil {
+        log.Fatalf("encrypt plaintext passwords: %v", err)
+    } else if n > 0 {
+        log.Printf("encrypted %d plaintext account passwords", n)
+    }
+    // Repair account states left behind by a crash or restart mid-login
+    if n, err := accounts.Reconcile(context.Background()); err != nil {
+        log.Fatalf("reconcile account states: %v", err)
+    } else if n > 0 {
+        log.Printf("reset %d stale CONNECTING/ONLINE accounts to IDLE", n)
+    }
+    if err := service.NewSessions(database).Reconcile(context.Background()); err != nil {
+        log.Fatalf("reconcile sessions: %v", err)
+    }
+
     // WebSocket hub
     hub := ws.NewHub()
     go hub.Run()
@@ -55,18 +84,82 @@ func main() {
     }
     if err != nil { log.Fatalf("ssh queue: %v", err) }
     uciClient := uci.New(q)
-    runner := &login.Runner{ BinaryPath: cfg.SZULoginPath }
-    server := api.New(database, hub, cfg.DBPath, uciClient, runner)
+    srun := &login.Srun{Host: cfg.SrunHost, ACID: cfg.SrunACID}
+    auth := login.NewRegistry()
+    auth.Register("exec", &login.Runner{ BinaryPath: cfg.SZULoginPath })
+    auth.Register("srun", srun)
+    if cfg.LoginScript != "" { auth.Register("script", &login.Script{Path: cfg.LoginScript}) }
+    auth.Register("ssh", &login.Remote{Exec: q, Srun: *srun})
+    // the mock never logs in for real, so it is only available when chosen explicitly
+    if cfg.LoginBackend == "mock" { auth.Register("mock", &login.Mock{}) }
+    auth.Default = cfg.LoginBackend
+    if auth.Default == "native" { auth.Default = "srun" }
+    if _, ok := auth.Get(""); !ok {
+        log.Fatalf("unknown NM_LOGIN_BACKEND %q (available: %v)", cfg.LoginBackend, auth.Names())
+    }
+    // appCtx outlives requests: background logins and the monitor stop only on shutdown
+    appCtx, stopApp := context.WithCancel(context.Background())
+    defer stopApp()
+    server := api.New(database, hub, cfg.DBPath, uciClient, auth, box)
+    server.Jobs = jobs.New(appCtx)
+    server.Portal = srun
+    server.LeaseTTL = time.Duration(cfg.LeaseTTL) * time.Second
+    server.LoginAttempts = cfg.LoginAttempts
+    server.RetryBackoff = time.Duration(cfg.RetryBackoff) * time.Second
+    server.Accounts.Health = service.HealthPolicy{
+        FailThreshold: cfg.FailThreshold,
+        Cooldown:      time.Duration(cfg.Cooldown) * time.Second,
+        MaxCooldown:   time.Duration(cfg.CooldownMax) * time.Second,
+    }
 
     mux := server.Routes()
     mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { ws.ServeWS(hub, w, r) })
 
     // Monitor (failover)
-    mon := monitor.New(hub, monitor.Config{Interval: time.Duration(cfg.MonitorEvery) * time.Second, TestURLs: cfg.MonitorURLs}, server.IfaceMap, func(ctx context.Context, wanIface string) {
+    monCfg := monitor.Config{
+        Interval:     time.Duration(cfg.MonitorEvery) * time.Second,
+        TestURLs:     cfg.MonitorURLs,
+        FailAfter:    cfg.FailAfter,
+        RecoverAfter: cfg.RecoverAfter,
+        MinFailover:  time.Duration(cfg.MinFailover) * time.Second,
+        MaxPerHour:   cfg.MaxFailovers,
+    }
+    mon := monitor.New(hub, monCfg, server.IfaceMap, func(ctx context.Context, wanIface string) {
         // delegate to server
         server.LoginForIface(ctx, wanIface)
     })
-    go mon.Run(context.Background())
+    if cfg.MonitorMode != "local" && cfg.MonitorMode != "router" {
+        log.Fatalf("unknown NM_MONITOR_MODE %q (local or router)", cfg.MonitorMode)
+    }
+    if cfg.MonitorMode == "router" {
+        // the WAN devices are on the router; query the portal from there too
+        server.PortalExec = q.Exec
+        server.Probes.Router = true
+    }
+    probeEnv := monitor.ProbeEnv{
+        Exec:       q.Exec,
+        RouterHTTP: cfg.MonitorMode == "router",
+        Portal:     monitor.NewPortalDetector(cfg.PortalHosts, cfg.PortalMarks),
+    }
+    mon.Probe = monitor.Default(cfg.MonitorURLs, 5*time.Second, probeEnv)
+    mon.ProbeFor = func(ctx context.Context, wanIface string) (monitor.Probe, error) {
+        specs, err := server.Probes.Get(ctx, wanIface)
+        if err != nil { return nil, err }
+        return monitor.Build(specs, probeEnv)
+    }
+    mon.Portal = func(ctx context.Context, wanIface string) (bool, error) {
+        st, err := server.PortalStatus(ctx, wanIface)
+        if err != nil { return false, err }
+        return st.Online, nil
+    }
+    mon.Healthy = func(ctx context.Context, wanIface string) {
+        // a working link means the session is still ours; keep the lease from running out
+        if err := server.Accounts.RenewIface(ctx, wanIface, server.LeaseTTL); err != nil {
+            log.Printf("renew lease on %s: %v", wanIface, err)
+        }
+    }
+    server.Monitor = mon
+    go mon.Run(appCtx)
 
     // Serve embedded UI if present
     if cfg.WebDir != "" {
@@ -93,11 +186,62 @@ func main() {
     stop := make(chan os.Signal, 1)
     signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
     <-stop
+    stopApp()
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
     _ = srv.Shutdown(ctx)
 }
 
+func loadBox(cfg *config.Config) *secret.Box {
+    key, created, err := secret.LoadKey(cfg.MasterKey, cfg.MasterKeyFile)
+    if err != nil { log.Fatalf("master key: %v", err) }
+    if created { log.Printf("generated new master key at %s; keep it safe, backups cannot be decrypted without it", cfg.MasterKeyFile) }
+    box, err := secret.New(key)
+    if err != nil { log.Fatalf("master key: %v", err) }
+    return box
+}
+
+// rotateKey re-encrypts all account passwords under a new master key.
+// Without -new-key-file a random key is generated and replaces the current key file.
+func rotateKey(cfg *config.Config, args []string) {
+    fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+    newKeyFile := fs.String("new-key-file", "", "file holding the new master key (default: generate one and replace NM_MASTER_KEY_FILE)")
+    _ = fs.Parse(args)
+    if cfg.MasterKey != "" && *newKeyFile == "" {
+        log.Fatalf("current key comes from NM_MASTER_KEY; pass -new-key-file and update NM_MASTER_KEY afterwards")
+    }
+
+    database, err := db.Open(cfg.DBPath)
+    if err != nil { log.Fatalf("open db: %v", err) }
+    defer database.Close()
+    if err := db.Migrate(database); err != nil { log.Fatalf("migrate db: %v", err) }
+    accounts := service.NewAccounts(database, loadBox(cfg))
+
+    // A generated key is staged next to the current one so it is never lost between commit and rename.
+    path := *newKeyFile
+    if path == "" {
+        path = cfg.MasterKeyFile + ".new"
+        key, err := secret.GenerateKey()
+        if err != nil { log.Fatalf("generate key: %v", err) }
+        if err := secret.WriteKey(path, key); err != nil { log.Fatalf("%v", err) }
+    }
+    key, _, err := secret.LoadKey("", path)
+    if err != nil { log.Fatalf("new key: %v", err) }
+    next, err := secret.New(key)
+    if err != nil { log.Fatalf("new key: %v", err) }
+
+    n, err := accounts.Rekey(context.Background(), next)
+    if err != nil { log.Fatalf("rotate key: %v", err) }
+    if *newKeyFile == "" {
+        if err := os.Rename(path, cfg.MasterKeyFile); err != nil {
+            log.Fatalf("re-encrypted %d passwords but could not replace key file, move %s to %s manually: %v", n, path, cfg.MasterKeyFile, err)
+        }
+        log.Printf("re-encrypted %d passwords; new key written to %s", n, cfg.MasterKeyFile)
+        return
+    }
+    log.Printf("re-encrypted %d passwords; point NM_MASTER_KEY_FILE (or NM_MASTER_KEY) at the new key before restarting", n)
+}
+
 // spaFallback serves index.html for unknown paths (for SPA routing), while letting /api and /ws pass through.
 func spaFallback(next http.Handler, dir string) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,170 @@
+package api
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+// writeError maps service errors onto HTTP status codes.
+func writeError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrIfaceNotMapped):
+        http.Error(w, err.Error(), 404)
+    case errors.Is(err, service.ErrInvalidAccount), errors.Is(err, service.ErrInvalidSettings),
+        errors.Is(err, service.ErrInvalidProfile):
+        http.Error(w, err.Error(), 400)
+    case errors.Is(err, service.ErrAccountOnline), errors.Is(err, service.ErrInvalidTransition),
+        errors.Is(err, service.ErrDuplicate):
+        http.Error(w, err.Error(), 409)
+    default:
+        http.Error(w, err.Error(), 500)
+    }
+}
+
+// accountView is the JSON shape of an account. It never carries the password;
+// see handleAccountAction ("reveal") for the audited way to read it.
+type accountView struct {
+    ID            int64    `json:"id"`
+    Username      string   `json:"username"`
+    Bandwidth     int      `json:"bandwidth"`
+    Status        string   `json:"status"`
+    LastUsedAt    int64    `json:"last_used_at"`
+    Disabled      bool     `json:"disabled"`
+    FailCount     int      `json:"fail_count"`
+    CooldownUntil int64    `json:"cooldown_until"`
+    Tags          []string `json:"tags"`
+}
+
+func toAccountView(a *models.Account) accountView {
+    return accountView{
+        ID: a.ID, Username: a.Username, Bandwidth: int(a.Bandwidth), Status: string(a.Status), LastUsedAt: a.LastUsedAt,
+        Disabled: a.Disabled, FailCount: a.FailCount, CooldownUntil: a.CooldownUntil, Tags: a.Tags,
+    }
+}
+
+func accountID(r *http.Request) (int64, bool) {
+    id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+    return id, err == nil && id > 0
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        list, err := s.Accounts.List(r.Context())
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        out := make([]accountView, 0, len(list))
+        for i := range list { out = append(out, toAccountView(&list[i])) }
+        writeJSON(w, out)
+    case http.MethodPost:
+        var req struct {
+            Username  string           `json:"username"`
+            Password  string           `json:"password"`
+            Bandwidth models.Bandwidth `json:"bandwidth"`
+            Tags      []string         `json:"tags"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
+        id, err := s.Accounts.Add(r.Context(), req.Username, req.Password, req.Bandwidth, req.Tags)
+        if err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"id": id})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
+
+// handleAccount serves a single account: GET reads it, PUT replaces all editable fields,
+// PATCH updates only the fields present in the body and DELETE removes it.
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+    id, ok := accountID(r)
+    if !ok { http.Error(w, "invalid account id", 400); return }
+    switch r.Method {
+    case http.MethodGet:
+        acct, err := s.Accounts.Get(r.Context(), id)
+        if err != nil { writeError(w, err); return }
+        writeJSON(w, toAccountView(acct))
+    case http.MethodPut, http.MethodPatch:
+        var req struct {
+            Username  *string           `json:"username"`
+            Password  *string           `json:"password"`
+            Bandwidth *models.Bandwidth `json:"bandwidth"`
+            Tags      *[]string         `json:"tags"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
+        // PUT replaces the account, except that an omitted password keeps the stored one
+        if r.Method == http.MethodPut && (req.Username == nil || req.Bandwidth == nil) {
+            http.Error(w, "username and bandwidth required", 400); return
+        }
+        u := service.AccountUpdate{Username: req.Username, Password: req.Password, Bandwidth: req.Bandwidth, Tags: req.Tags}
+        if err := s.Accounts.Update(r.Context(), id, u); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
+    case http.MethodDelete:
+        if err := s.Accounts.Delete(r.Context(), id); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
+
+// handleAccountAction serves POST /api/accounts/{id}/enable, /disable and /reveal.
+func (s *Server) handleAccountAction(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    id, ok := accountID(r)
+    if !ok { http.Error(w, "invalid account id", 400); return }
+    var err error
+    switch r.PathValue("action") {
+    case "reveal":
+        s.revealPassword(w, r, id); return
+    case "enable":
+        err = s.Accounts.SetDisabled(r.Context(), id, false)
+    case "disable":
+        err = s.Accounts.SetDisabled(r.Context(), id, true)
+    default:
+        http.Error(w, "unknown action", 404); return
+    }
+    if err != nil { writeError(w, err); return }
+    writeJSON(w, map[string]any{"ok": true})
+}
+
+// revealPassword returns the decrypted password. The reveal is written to the audit log
+// first; if that fails the password is not returned.
+func (s *Server) revealPassword(w http.ResponseWriter, r *http.Request, id int64) {
+    acct, err := s.Accounts.Get(r.Context(), id)
+    if err != nil { writeError(w, err); return }
+    password, err := s.Accounts.Password(acct)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    target := fmt.Sprintf("account:%d", acct.ID)
+    if err := s.Audit.Record(r.Context(), "reveal_password", target, clientAddr(r), acct.Username); err != nil {
+        http.Error(w, "audit log unavailable: "+err.Error(), 500); return
+    }
+    writeJSON(w, map[string]any{"id": acct.ID, "username": acct.Username, "password": password})
+}
+
+// clientAddr returns the peer address, preferring X-Forwarded-For when behind a proxy.
+func clientAddr(r *http.Request) string {
+    if v := r.Header.Get("X-Forwarded-For"); v != "" { return v + " via " + r.RemoteAddr }
+    return r.RemoteAddr
+}
+
+type auditView struct {
+    ID     int64  `json:"id"`
+    At     int64  `json:"at"`
+    Action string `json:"action"`
+    Target string `json:"target"`
+    Remote string `json:"remote"`
+    Detail string `json:"detail"`
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+    list, err := s.Audit.List(r.Context(), limit)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    out := make([]auditView, 0, len(list))
+    for _, e := range list { out = append(out, auditView(e)) }
+    writeJSON(w, out)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+    "sync"
+    "time"
+)
+
+// loginCoalesce is how long after a login finishes further triggers for the same interface
+// are treated as duplicates of it.
+const loginCoalesce = 10 * time.Second
+
+// loginRun is one login on an interface; done is closed when it finishes.
+type loginRun struct {
+    StartedAt  time.Time
+    FinishedAt time.Time
+    JobID      string // set when the login runs as a job
+    Kind       string // "login", or "logout" for an exclusive run
+    done       chan struct{}
+}
+
+// busyError is returned by operations refused because run holds the interface.
+type busyError struct { run *loginRun }
+
+func (e *busyError) Error() string { return "a " + e.run.Kind + " is running on this interface" }
+
+// loginGate allows one login per interface at a time and coalesces triggers that arrive while
+// a login runs or shortly after it finished.
+type loginGate struct {
+    mu   sync.Mutex
+    runs map[string]*loginRun
+}
+
+func newLoginGate() *loginGate { return &loginGate{runs: map[string]*loginRun{}} }
+
+// begin returns a new run and true if the caller should log wanIface in, or the running or
+// just finished run and false otherwise.
+func (g *loginGate) begin(wanIface string) (*loginRun, bool) {
+    g.mu.Lock(); defer g.mu.Unlock()
+    if run := g.runs[wanIface]; run != nil && (run.FinishedAt.IsZero() || time.Since(run.FinishedAt) < loginCoalesce) {
+        return run, false
+    }
+    run := &loginRun{StartedAt: time.Now(), Kind: "login", done: make(chan struct{})}
+    g.runs[wanIface] = run
+    return run, true
+}
+
+// exclusive holds wanIface for an operation that must not overlap a login, such as a logout. It
+// fails with the running login or logout, if any. Logins that arrive meanwhile are refused like
+// duplicates; once released the run is forgotten, so it does not coalesce later logins.
+func (g *loginGate) exclusive(wanIface, kind string) (*loginRun, bool) {
+    g.mu.Lock(); defer g.mu.Unlock()
+    if run := g.runs[wanIface]; run != nil && run.FinishedAt.IsZero() { return run, false }
+    run := &loginRun{StartedAt: time.Now(), Kind: kind, done: make(chan struct{})}
+    g.runs[wanIface] = run
+    return run, true
+}
+
+// release ends an exclusive run.
+func (g *loginGate) release(wanIface string, run *loginRun) {
+    g.mu.Lock(); defer g.mu.Unlock()
+    run.FinishedAt = time.Now()
+    close(run.done)
+    if g.runs[wanIface] == run { delete(g.runs, wanIface) }
+}
+
+func (g *loginGate) end(run *loginRun) {
+    g.mu.Lock(); defer g.mu.Unlock()
+    run.FinishedAt = time.Now()
+    close(run.done)
+}
+
+// attach records the job running run, so coalesced callers can follow it.
+func (g *loginGate) attach(run *loginRun, jobID string) {
+    g.mu.Lock(); defer g.mu.Unlock()
+    run.JobID = jobID
+}
+
+// status describes run for the 409 answer to a coalesced or refused request.
+func (g *loginGate) status(wanIface string, run *loginRun) map[string]any {
+    g.mu.Lock(); defer g.mu.Unlock()
+    out := map[string]any{"wan": wanIface, "kind": run.Kind, "started_at": run.StartedAt.Unix()}
+    if run.JobID != "" { out["job_id"] = run.JobID }
+    if run.FinishedAt.IsZero() {
+        out["state"] = "in_progress"
+    } else {
+        out["state"] = "just_finished"
+        out["finished_at"] = run.FinishedAt.Unix()
+    }
+    return out
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+    "net/http"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/jobs"
+)
+
+type jobStepView struct {
+    At      int64  `json:"at"`
+    Message string `json:"message"`
+}
+
+type jobView struct {
+    ID         string        `json:"id"`
+    Kind       string        `json:"kind"`
+    Target     string        `json:"target"`
+    State      string        `json:"state"`
+    Error      string        `json:"error,omitempty"`
+    CreatedAt  int64         `json:"created_at"`
+    FinishedAt int64         `json:"finished_at"`
+    Steps      []jobStepView `json:"steps,omitempty"`
+}
+
+func toJobView(j jobs.Job, steps bool) jobView {
+    v := jobView{ID: j.ID, Kind: j.Kind, Target: j.Target, State: j.State, Error: j.Error, CreatedAt: j.CreatedAt.Unix()}
+    if !j.FinishedAt.IsZero() { v.FinishedAt = j.FinishedAt.Unix() }
+    if steps {
+        v.Steps = make([]jobStepView, 0, len(j.Steps))
+        for _, st := range j.Steps { v.Steps = append(v.Steps, jobStepView{At: st.At.Unix(), Message: st.Message}) }
+    }
+    return v
+}
+
+// handleJobs lists recent background jobs, newest first, without their steps.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    list := s.Jobs.List()
+    out := make([]jobView, 0, len(list))
+    for _, j := range list { out = append(out, toJobView(j, false)) }
+    writeJSON(w, out)
+}
+
+// handleJob shows a job with its progress steps (GET) or cancels it (DELETE).
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+    id := r.PathValue("id")
+    switch r.Method {
+    case http.MethodGet:
+        j, ok := s.Jobs.Get(id)
+        if !ok { http.Error(w, "job not found", 404); return }
+        writeJSON(w, toJobView(j, true))
+    case http.MethodDelete:
+        j, ok := s.Jobs.Get(id)
+        if !ok { http.Error(w, "job not found", 404); return }
+        if !s.Jobs.Cancel(id) { http.Error(w, "job already "+j.State, 409); return }
+        writeJSON(w, map[string]any{"ok": true})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
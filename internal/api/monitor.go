@@ -0,0 +1,66 @@
+package api
+
+import (
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+type monitorView struct {
+    WanIface          string `json:"wan_iface"`
+    State             string `json:"state"` // up, needs_login or outage; empty until the first verdict
+    Failures          int    `json:"failures"`
+    Successes         int    `json:"successes"`
+    LastFailover      int64  `json:"last_failover"`
+    FailoversLastHour int    `json:"failovers_last_hour"`
+    Tripped           bool   `json:"tripped"`
+}
+
+// handleMonitor shows the monitor's per-interface failover state.
+func (s *Server) handleMonitor(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    if s.Monitor == nil { http.Error(w, "monitor not running", 503); return }
+    list := s.Monitor.Status()
+    out := make([]monitorView, 0, len(list))
+    for _, x := range list {
+        v := monitorView{WanIface: x.WanIface, State: x.State, Failures: x.Failures, Successes: x.Successes, FailoversLastHour: x.FailoversHr, Tripped: x.Tripped}
+        if !x.LastFailover.IsZero() { v.LastFailover = x.LastFailover.Unix() }
+        out = append(out, v)
+    }
+    writeJSON(w, out)
+}
+
+// handleMonitorReset closes an interface's failover circuit breaker: POST /api/monitor/{wan}/reset.
+func (s *Server) handleMonitorReset(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    if s.Monitor == nil { http.Error(w, "monitor not running", 503); return }
+    wanIface := r.PathValue("wan")
+    _, err := s.IfaceMap.Get(r.Context(), wanIface)
+    if errors.Is(err, sql.ErrNoRows) { http.Error(w, "interface not mapped", 404); return }
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    s.Monitor.Reset(wanIface)
+    writeJSON(w, map[string]any{"ok": true})
+}
+
+// handleProbes reads or replaces the health probes of an interface. An empty list restores the
+// default probe (NM_MONITOR_URLS).
+func (s *Server) handleProbes(w http.ResponseWriter, r *http.Request) {
+    wanIface := r.PathValue("wan")
+    switch r.Method {
+    case http.MethodGet:
+        specs, err := s.Probes.Get(r.Context(), wanIface)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if specs == nil { specs = []service.ProbeSpec{} }
+        writeJSON(w, map[string]any{"probes": specs, "default": len(specs) == 0})
+    case http.MethodPut:
+        var req struct{ Probes []service.ProbeSpec `json:"probes"` }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
+        if err := s.Probes.Set(r.Context(), wanIface, req.Probes); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+    "github.com/Sleepstars/SZU-NetManager/internal/mwan"
+)
+
+type mwanInterfaceView struct {
+    Name      string `json:"name"`
+    State     string `json:"state"`
+    Online    bool   `json:"online"`
+    OnlineSec int64  `json:"online_sec"`
+    UptimeSec int64  `json:"uptime_sec"`
+    Tracking  string `json:"tracking"`
+}
+
+type mwanMemberView struct {
+    Interface string `json:"interface"`
+    Percent   int    `json:"percent"`
+}
+
+type mwanPolicyView struct {
+    Family   string           `json:"family"`
+    Name     string           `json:"name"`
+    Members  []mwanMemberView `json:"members"`
+    Fallback string           `json:"fallback,omitempty"`
+}
+
+type mwanStatusView struct {
+    Interfaces []mwanInterfaceView `json:"interfaces"`
+    Policies   []mwanPolicyView    `json:"policies"`
+    Status     string              `json:"status"` // raw `mwan3 status` output
+}
+
+func toMWANStatusView(st *mwan.Status, raw string) mwanStatusView {
+    v := mwanStatusView{Interfaces: []mwanInterfaceView{}, Policies: []mwanPolicyView{}, Status: raw}
+    for _, i := range st.Interfaces {
+        v.Interfaces = append(v.Interfaces, mwanInterfaceView{
+            Name: i.Name, State: i.State, Online: i.IsOnline(), OnlineSec: int64(i.Online.Seconds()),
+            UptimeSec: int64(i.Uptime.Seconds()), Tracking: i.Tracking,
+        })
+    }
+    for _, p := range st.Policies {
+        pv := mwanPolicyView{Family: p.Family, Name: p.Name, Members: []mwanMemberView{}, Fallback: p.Fallback}
+        for _, m := range p.Members { pv.Members = append(pv.Members, mwanMemberView{Interface: m.Interface, Percent: m.Percent}) }
+        v.Policies = append(v.Policies, pv)
+    }
+    return v
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/login"
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+type profileView struct {
+    WanIface      string `json:"wan_iface"`
+    Authenticator string `json:"authenticator"`
+    Host          string `json:"host"`
+    Area          string `json:"area"`
+    BindIP        string `json:"bind_ip"`
+    TimeoutSec    int    `json:"timeout_sec"`
+    Retries       int    `json:"retries"`
+}
+
+func toProfileView(p service.LoginProfile) profileView {
+    return profileView{
+        WanIface: p.WanIface, Authenticator: p.Authenticator, Host: p.Host, Area: p.Area, BindIP: p.BindIP,
+        TimeoutSec: int(p.Timeout / time.Second), Retries: p.Retries,
+    }
+}
+
+// loginTarget is everything a login path needs to reach the portal through an interface.
+type loginTarget struct {
+    nic     string
+    auth    login.Authenticator
+    profile service.LoginProfile
+    ip      string
+}
+
+// target resolves the NIC, login profile, authenticator and login IP of wanIface. Without a
+// bind IP in the profile the interface address is read from the router; if that fails the
+// authenticator falls back to whatever address the portal sees. The IP is only reported to the
+// portal; authenticators bind to the NIC, never to the address.
+func (s *Server) target(ctx context.Context, wanIface string) (*loginTarget, error) {
+    nic, err := s.IfaceMap.Get(ctx, wanIface)
+    if errors.Is(err, sql.ErrNoRows) || (err == nil && nic == "") { return nil, service.ErrIfaceNotMapped }
+    if err != nil { return nil, err }
+    p, err := s.Profiles.Get(ctx, wanIface)
+    if err != nil { return nil, err }
+    auth, ok := s.Auth.Get(p.Authenticator)
+    if !ok { return nil, fmt.Errorf("%w: authenticator %q is not available", service.ErrInvalidProfile, p.Authenticator) }
+    t := &loginTarget{nic: nic, auth: auth, profile: p, ip: p.BindIP}
+    if t.ip == "" && s.UCI != nil {
+        if ip, err := s.UCI.InterfaceIP(wanIface); err == nil {
+            t.ip = ip
+        } else {
+            log.Printf("detect %s address: %v", wanIface, err)
+        }
+    }
+    return t, nil
+}
+
+// handleProfile reads or replaces the login profile of an interface. Fields left out of a PUT
+// fall back to their defaults.
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+    wanIface := r.PathValue("wan")
+    switch r.Method {
+    case http.MethodGet:
+        p, err := s.Profiles.Get(r.Context(), wanIface)
+        if err != nil { writeError(w, err); return }
+        writeJSON(w, toProfileView(p))
+    case http.MethodPut:
+        var req profileView
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
+        if _, ok := s.Auth.Get(req.Authenticator); !ok {
+            http.Error(w, fmt.Sprintf("unknown authenticator %q", req.Authenticator), 400); return
+        }
+        p := service.LoginProfile{
+            WanIface: wanIface, Authenticator: req.Authenticator, Host: req.Host, Area: req.Area, BindIP: req.BindIP,
+            Timeout: time.Duration(req.TimeoutSec) * time.Second, Retries: req.Retries,
+        }
+        if err := s.Profiles.Set(r.Context(), p); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
+
+func (s *Server) handleAuthenticators(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    writeJSON(w, map[string]any{"authenticators": s.Auth.Names(), "default": s.Auth.Default})
+}
@@ -4,15 +4,22 @@ import (
     "context"
     "database/sql"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
+    "log"
     "net/http"
     "os"
     "path/filepath"
+    "strings"
     "time"
 
+    "github.com/Sleepstars/SZU-NetManager/internal/jobs"
     "github.com/Sleepstars/SZU-NetManager/internal/login"
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+    "github.com/Sleepstars/SZU-NetManager/internal/monitor"
     "github.com/Sleepstars/SZU-NetManager/internal/mwan"
+    "github.com/Sleepstars/SZU-NetManager/internal/secret"
     "github.com/Sleepstars/SZU-NetManager/internal/service"
     "github.com/Sleepstars/SZU-NetManager/internal/uci"
     "github.com/Sleepstars/SZU-NetManager/internal/ws"
@@ -20,27 +27,76 @@ import (
 )
 
 type Server struct {
-    DB        *sql.DB
-    Hub       *ws.Hub
-    Accounts  *service.Accounts
-    IfaceMap  *service.IfaceMap
-    UCI       *uci.Client
-    MWAN      *mwan.Service
-    Runner    *login.Runner
-    DBPath    string
+    DB            *sql.DB
+    Hub           *ws.Hub
+    Accounts      *service.Accounts
+    Audit         *service.Audit
+    Sessions      *service.Sessions
+    IfaceMap      *service.IfaceMap
+    UCI           *uci.Client
+    MWAN          *mwan.Service
+    Auth          *login.Registry // authenticators by name; each interface's profile picks one
+    Profiles      *service.Profiles
+    Probes        *service.Probes // per-interface health checks used by the monitor
+    Portal        *login.Srun // portal status queries, independent of the login backend
+    // PortalExec, when set, runs portal status queries on the router (router monitor mode), where
+    // the WAN devices live; otherwise they leave this host bound to the mapped NIC.
+    PortalExec    func(cmd string) (string, error)
+    DBPath        string
+    LeaseTTL      time.Duration // how long a successful login keeps its account leased
+    // a failover tries up to LoginAttempts accounts, waiting RetryBackoff (doubling) in between
+    LoginAttempts int
+    RetryBackoff  time.Duration
+    Jobs          *jobs.Manager // background logins; its context should live as long as the process
+    Monitor       *monitor.Monitor // optional; failover state and breaker reset
+    logins        *loginGate
 }
 
-func New(dbConn *sql.DB, hub *ws.Hub, dbPath string, uciClient *uci.Client, runner *login.Runner) *Server {
-    return &Server{
-        DB:        dbConn,
-        Hub:       hub,
-        Accounts:  service.NewAccounts(dbConn),
-        IfaceMap:  service.NewIfaceMap(dbConn),
-        UCI:       uciClient,
-        MWAN:      mwan.New(uciClient),
-        Runner:    runner,
-        DBPath:    dbPath,
+// claimTTL bounds a lease while the login is still in progress, so a crash mid-login frees the
+// account: every attempt the profile allows may run to its timeout, plus claimMargin for the
+// bookkeeping around them.
+func claimTTL(p service.LoginProfile) time.Duration {
+    return p.Timeout*time.Duration(p.Retries+1) + claimMargin
+}
+
+const claimMargin = time.Minute
+
+// loginFailureText describes classified login failures in hub messages.
+var loginFailureText = map[login.Kind]string{
+    login.KindWrongPassword: "账号或密码错误",
+    login.KindArrears:       "账号欠费",
+    login.KindDeviceLimit:   "在线设备数已达上限",
+    login.KindUnreachable:   "认证网关不可达",
+    login.KindTimeout:       "登录超时",
+    login.KindRejected:      "认证网关拒绝登录",
+    login.KindUnknown:       "未知错误",
+}
+
+func New(dbConn *sql.DB, hub *ws.Hub, dbPath string, uciClient *uci.Client, auth *login.Registry, box *secret.Box) *Server {
+    s := &Server{
+        DB:            dbConn,
+        Hub:           hub,
+        Accounts:      service.NewAccounts(dbConn, box),
+        Audit:         service.NewAudit(dbConn),
+        Sessions:      service.NewSessions(dbConn),
+        IfaceMap:      service.NewIfaceMap(dbConn),
+        UCI:           uciClient,
+        MWAN:          mwan.New(uciClient),
+        Auth:          auth,
+        Profiles:      service.NewProfiles(dbConn),
+        Probes:        service.NewProbes(service.NewSettings(dbConn)),
+        Portal:        &login.Srun{},
+        DBPath:        dbPath,
+        LeaseTTL:      24 * time.Hour,
+        LoginAttempts: 3,
+        RetryBackoff:  5 * time.Second,
+        Jobs:          jobs.New(context.Background()),
+        logins:        newLoginGate(),
+    }
+    s.Accounts.OnStateChange = func(c models.StateChange) {
+        hub.Broadcast(fmt.Sprintf("账号 %s 状态变更: %s → %s", c.Username, c.From, c.To))
     }
+    return s
 }
 
 func (s *Server) Routes() *http.ServeMux {
@@ -49,8 +105,26 @@ func (s *Server) Routes() *http.ServeMux {
     mux.HandleFunc("/api/mwan/interfaces", s.handleMWANInterfaces)
     mux.HandleFunc("/api/mwan/status", s.handleMWANStatus)
     mux.HandleFunc("/api/iface-map", s.handleIfaceMap)
+    mux.HandleFunc("/api/iface-map/{wan}/pool", s.handleIfacePool)
+    mux.HandleFunc("/api/interfaces/{wan}/portal", s.handlePortalStatus)
+    mux.HandleFunc("/api/interfaces/{wan}/profile", s.handleProfile)
+    mux.HandleFunc("/api/interfaces/{wan}/probes", s.handleProbes)
+    mux.HandleFunc("/api/authenticators", s.handleAuthenticators)
     mux.HandleFunc("/api/accounts", s.handleAccounts)
+    mux.HandleFunc("/api/accounts/import", s.handleAccountsImport)
+    mux.HandleFunc("/api/accounts/export", s.handleAccountsExport)
+    mux.HandleFunc("/api/accounts/{id}", s.handleAccount)
+    mux.HandleFunc("/api/accounts/{id}/{action}", s.handleAccountAction)
+    mux.HandleFunc("/api/leases", s.handleLeases)
+    mux.HandleFunc("/api/sessions", s.handleSessions)
+    mux.HandleFunc("/api/settings/selection", s.handleSelectionSettings)
+    mux.HandleFunc("/api/audit", s.handleAudit)
     mux.HandleFunc("/api/login/start", s.handleLoginStart)
+    mux.HandleFunc("/api/jobs", s.handleJobs)
+    mux.HandleFunc("/api/jobs/{id}", s.handleJob)
+    mux.HandleFunc("/api/monitor", s.handleMonitor)
+    mux.HandleFunc("/api/monitor/{wan}/reset", s.handleMonitorReset)
+    mux.HandleFunc("/api/logout", s.handleLogout)
     mux.HandleFunc("/api/backup", s.handleBackup)
     mux.HandleFunc("/api/restore", s.handleRestore)
     return mux
@@ -72,10 +146,11 @@ func (s *Server) handleMWANInterfaces(w http.ResponseWriter, r *http.Request) {
     writeJSON(w, out)
 }
 
+// handleMWANStatus returns `mwan3 status` parsed into interfaces and policies, plus the raw text.
 func (s *Server) handleMWANStatus(w http.ResponseWriter, r *http.Request) {
-    raw, err := s.UCI.Status()
+    st, raw, err := s.MWAN.Status()
     if err != nil { http.Error(w, err.Error(), 500); return }
-    writeJSON(w, map[string]any{"status": raw})
+    writeJSON(w, toMWANStatusView(st, raw))
 }
 
 func (s *Server) handleIfaceMap(w http.ResponseWriter, r *http.Request) {
@@ -85,7 +160,10 @@ func (s *Server) handleIfaceMap(w http.ResponseWriter, r *http.Request) {
         if err != nil { http.Error(w, err.Error(), 500); return }
         writeJSON(w, m)
     case http.MethodPost:
-        var req struct{ WanIface, Nic string }
+        var req struct {
+            WanIface string `json:"wan_iface"`
+            Nic      string `json:"nic"`
+        }
         if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
         if req.WanIface == "" || req.Nic == "" { http.Error(w, "wan_iface and nic required", 400); return }
         if err := s.IfaceMap.Set(r.Context(), req.WanIface, req.Nic); err != nil { http.Error(w, err.Error(), 500); return }
@@ -95,64 +173,320 @@ func (s *Server) handleIfaceMap(w http.ResponseWriter, r *http.Request) {
     }
 }
 
-func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+// handleIfacePool reads or replaces the account pool rule of a mapped interface.
+func (s *Server) handleIfacePool(w http.ResponseWriter, r *http.Request) {
+    wanIface := r.PathValue("wan")
     switch r.Method {
     case http.MethodGet:
-        list, err := s.Accounts.List(r.Context())
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        writeJSON(w, list)
-    case http.MethodPost:
-        var req struct{ Username, Password string; Bandwidth int }
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil { http.Error(w, err.Error(), 400); return }
-        if req.Username == "" || req.Password == "" || req.Bandwidth <= 0 { http.Error(w, "invalid payload", 400); return }
-        id, err := s.Accounts.Add(r.Context(), req.Username, req.Password, req.Bandwidth)
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        writeJSON(w, map[string]any{"id": id})
+        p, err := s.IfaceMap.Pool(r.Context(), wanIface)
+        if err != nil { writeError(w, err); return }
+        writeJSON(w, p)
+    case http.MethodPut:
+        var p service.PoolRule
+        if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, err.Error(), 400); return }
+        if err := s.IfaceMap.SetPool(r.Context(), wanIface, p); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
     default:
         http.Error(w, "method not allowed", 405)
     }
 }
 
-// handleLoginStart triggers login for a given mwan iface (e.g., wan or wanb), selects next account, applies weight, and broadcasts logs.
+// PortalStatus asks the portal who is online on wanIface: from the router when PortalExec is set,
+// else through the NIC mapped to it.
+func (s *Server) PortalStatus(ctx context.Context, wanIface string) (*login.PortalStatus, error) {
+    t, err := s.target(ctx, wanIface)
+    if err != nil { return nil, err }
+    if s.PortalExec != nil { return s.Portal.StatusOnRouter(s.PortalExec, wanIface, t.profile.Host, 10*time.Second) }
+    qctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+    return s.Portal.Status(qctx, t.nic, t.profile.Host)
+}
+
+func (s *Server) handlePortalStatus(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    st, err := s.PortalStatus(r.Context(), r.PathValue("wan"))
+    if errors.Is(err, service.ErrIfaceNotMapped) { http.Error(w, err.Error(), 404); return }
+    if err != nil { http.Error(w, err.Error(), 502); return }
+    out := map[string]any{
+        "online": st.Online, "username": st.Username, "ip": st.IP,
+        "login_at": int64(0), "session_sec": int64(st.SessionTime.Seconds()),
+        "used_bytes": st.UsedBytes, "bytes_in": st.BytesIn, "bytes_out": st.BytesOut,
+    }
+    if !st.LoginAt.IsZero() { out["login_at"] = st.LoginAt.Unix() }
+    writeJSON(w, out)
+}
+
+// handleLoginStart starts a login job for a given mwan iface (e.g., wan or wanb) and returns its id;
+// the job selects the next account, applies weight, and broadcasts logs. Follow it with /api/jobs/{id}.
+// While a login for the interface runs or has just finished it answers 409 with that login's state.
 func (s *Server) handleLoginStart(w http.ResponseWriter, r *http.Request) {
     wanIface := r.URL.Query().Get("wan")
     if wanIface == "" { http.Error(w, "wan query required", 400); return }
-    go s.LoginForIface(r.Context(), wanIface)
-    writeJSON(w, map[string]any{"ok": true})
+    run, ok := s.logins.begin(wanIface)
+    if !ok {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        _ = json.NewEncoder(w).Encode(s.logins.status(wanIface, run))
+        return
+    }
+    id := s.Jobs.Start("login", wanIface, func(ctx context.Context) error {
+        defer s.logins.end(run)
+        return s.loginIface(ctx, wanIface)
+    })
+    s.logins.attach(run, id)
+    writeJSON(w, map[string]any{"ok": true, "job_id": id})
+}
+
+// LoginForIface logs wanIface in with the next account. If a login for the interface is already
+// running, or finished moments ago, it waits for that one instead and returns false.
+func (s *Server) LoginForIface(ctx context.Context, wanIface string) bool {
+    run, ok := s.logins.begin(wanIface)
+    if !ok && run.Kind == "logout" {
+        s.Hub.Broadcast(fmt.Sprintf("%s 接口正在注销，跳过本次登录", wanIface))
+        <-run.done
+        return false
+    }
+    if !ok {
+        s.Hub.Broadcast(fmt.Sprintf("%s 接口已有登录在进行或刚刚完成，合并本次请求", wanIface))
+        <-run.done
+        return false
+    }
+    defer s.logins.end(run)
+    _ = s.loginIface(ctx, wanIface)
+    return true
 }
 
-func (s *Server) LoginForIface(ctx context.Context, wanIface string) {
-    s.Hub.Broadcast(fmt.Sprintf("开始为 %s 接口登录新账号", wanIface))
+// report broadcasts msg and records it as a step of the job running under ctx, if any.
+func (s *Server) report(ctx context.Context, msg string) {
+    s.Hub.Broadcast(msg)
+    jobs.Report(ctx, msg)
+}
 
-    nic, err := s.IfaceMap.Get(ctx, wanIface)
-    if err != nil { s.Hub.Broadcast(fmt.Sprintf("获取网卡映射失败: %v", err)); return }
-    if nic == "" { s.Hub.Broadcast("未配置网卡映射，请先在设置中选择 NIC"); return }
+// failf reports why a login gave up and returns the same text as its error.
+func (s *Server) failf(ctx context.Context, format string, args ...any) error {
+    msg := fmt.Sprintf(format, args...)
+    s.report(ctx, msg)
+    return errors.New(msg)
+}
 
-    acct, err := s.Accounts.NextCandidate(ctx)
-    if err != nil { s.Hub.Broadcast(fmt.Sprintf("选择账号失败: %v", err)); return }
-    if acct == nil { s.Hub.Broadcast("没有可用账号"); return }
+// loginIface logs wanIface in, trying further accounts when one fails. Cancelling ctx stops it
+// between accounts and aborts the running login.
+func (s *Server) loginIface(ctx context.Context, wanIface string) error {
+    s.report(ctx, fmt.Sprintf("开始为 %s 接口登录新账号", wanIface))
 
-    _ = s.Accounts.UpdateState(ctx, acct.ID, "CONNECTING")
+    t, err := s.target(ctx, wanIface)
+    if errors.Is(err, service.ErrIfaceNotMapped) { return s.failf(ctx, "未配置网卡映射，请先在设置中选择 NIC") }
+    if err != nil { return s.failf(ctx, "读取登录配置失败: %v", err) }
 
-    // Invoke SZU-login
-    if err := s.Runner.LoginWithTimeout(nic, acct.Username, acct.Password, "", true, "", 40*time.Second); err != nil {
-        s.Hub.Broadcast(fmt.Sprintf("%s 接口登录失败: %v", wanIface, err))
-        _ = s.Accounts.UpdateState(ctx, acct.ID, "RETRYING")
-        return
+    // Try up to LoginAttempts different accounts, backing off between them. Accounts tried in
+    // this round are not claimed again.
+    var tried []int64
+    backoff := s.RetryBackoff
+    for n := 1; ; n++ {
+        // Claim leases the account to this interface and marks it CONNECTING in one transaction
+        acct, err := s.Accounts.Claim(ctx, wanIface, claimTTL(t.profile), tried...)
+        if err != nil { return s.failf(ctx, "选择账号失败: %v", err) }
+        if acct == nil && n == 1 { return s.failf(ctx, "没有可用账号") }
+        if acct == nil { return s.failf(ctx, "%s 接口可用账号已全部尝试，放弃本次登录", wanIface) }
+        tried = append(tried, acct.ID)
+        if n > 1 { s.report(ctx, fmt.Sprintf("%s 接口尝试第 %d 个账号 %s", wanIface, n, acct.Username)) }
+
+        err = s.loginAccount(ctx, wanIface, t, acct)
+        if err == nil { return nil }
+        if ctx.Err() != nil {
+            s.report(ctx, fmt.Sprintf("%s 接口登录已取消", wanIface))
+            return ctx.Err()
+        }
+        if !login.AccountFault(err) {
+            s.report(ctx, fmt.Sprintf("%s 接口登录失败且与账号无关，不再更换账号", wanIface))
+            return err
+        }
+        if n >= s.LoginAttempts {
+            s.report(ctx, fmt.Sprintf("%s 接口已尝试 %d 个账号均失败，停止重试", wanIface, n))
+            return err
+        }
+        s.report(ctx, fmt.Sprintf("%s 后为 %s 接口尝试下一个账号", backoff, wanIface))
+        select {
+        case <-time.After(backoff):
+        case <-ctx.Done():
+            s.report(ctx, fmt.Sprintf("%s 接口登录已取消", wanIface))
+            return ctx.Err()
+        }
+        backoff *= 2
+    }
+}
+
+// loginAccount logs wanIface in with the claimed account and records the outcome. On failure the
+// lease is released and the login error is returned so the caller can decide whether another
+// account may help. Bookkeeping uses dbCtx so that a cancelled job still records its outcome.
+func (s *Server) loginAccount(ctx context.Context, wanIface string, t *loginTarget, acct *models.Account) error {
+    dbCtx := context.WithoutCancel(ctx)
+    sid, err := s.Sessions.Start(dbCtx, wanIface, t.nic, acct)
+    if err != nil { log.Printf("record session: %v", err) }
+
+    password, err := s.Accounts.Password(acct)
+    if err != nil {
+        s.report(ctx, fmt.Sprintf("解密账号密码失败: %v", err))
+        _ = s.Sessions.Fail(dbCtx, sid, "", err.Error())
+        _ = s.Accounts.Release(dbCtx, acct.ID)
+        _ = s.Accounts.Transition(dbCtx, acct.ID, models.StateIdle)
+        return err
+    }
+
+    // Invoke the interface's authenticator, streaming its output to the hub. Timeouts and an
+    // unreachable portal are retried with the same account as often as the profile allows.
+    var output strings.Builder
+    for attempt := 0; ; attempt++ {
+        lctx, cancel := context.WithTimeout(ctx, t.profile.Timeout)
+        lctx = login.WithOutput(lctx, func(line string) {
+            output.WriteString(line + "\n")
+            s.report(ctx, fmt.Sprintf("[%s] %s", wanIface, line))
+        })
+        err = t.auth.Login(lctx, t.nic, acct.Username, password, t.profile.Host, t.profile.Teaching(), t.ip)
+        cancel()
+        if err == nil || ctx.Err() != nil || !login.Transient(err) || attempt >= t.profile.Retries { break }
+        s.report(ctx, fmt.Sprintf("%s 接口登录失败（%s），重试第 %d 次...", wanIface, loginFailureText[login.KindOf(err)], attempt+1))
+    }
+    _ = s.Sessions.SetOutput(dbCtx, sid, output.String())
+    if err != nil && ctx.Err() != nil {
+        // cancelled: neither the account nor the portal is to blame
+        _ = s.Sessions.Fail(dbCtx, sid, "", "cancelled")
+        _ = s.Accounts.Release(dbCtx, acct.ID)
+        _ = s.Accounts.Transition(dbCtx, acct.ID, models.StateIdle)
+        return ctx.Err()
+    }
+    if err != nil {
+        kind := login.KindOf(err)
+        s.report(ctx, fmt.Sprintf("%s 接口账号 %s 登录失败（%s）: %v", wanIface, acct.Username, loginFailureText[kind], err))
+        _ = s.Sessions.Fail(dbCtx, sid, string(kind), err.Error())
+        _ = s.Accounts.Release(dbCtx, acct.ID)
+        switch {
+        case !login.AccountFault(err):
+            // the portal, the link or the setup is at fault; the account keeps its health record
+            _ = s.Accounts.Transition(dbCtx, acct.ID, models.StateIdle)
+        case login.Permanent(err):
+            _ = s.Accounts.RecordPermanentFailure(dbCtx, acct.ID)
+            s.report(ctx, fmt.Sprintf("账号 %s %s，已停用，修正后请重新启用", acct.Username, loginFailureText[kind]))
+        default:
+            if state, err := s.Accounts.RecordFailure(dbCtx, acct.ID); err == nil && state == models.StateFailed {
+                s.report(ctx, fmt.Sprintf("账号 %s 连续登录失败，已暂停使用并进入冷却", acct.Username))
+            }
+        }
+        return err
     }
 
-    _ = s.Accounts.UpdateState(ctx, acct.ID, "ONLINE")
-    _ = s.Accounts.MarkUsedNow(ctx, acct.ID)
-    s.Hub.Broadcast(fmt.Sprintf("%s 接口登录成功！", wanIface))
+    _ = s.Accounts.RecordSuccess(dbCtx, acct.ID)
+    if err := s.Accounts.Renew(dbCtx, wanIface, acct.ID, s.LeaseTTL); err != nil {
+        // the account is no longer ours to mark ONLINE; leave its state to whoever holds it now
+        log.Printf("renew lease of account %d on %s: %v", acct.ID, wanIface, err)
+        s.report(ctx, fmt.Sprintf("%s 接口账号 %s 的租约已丢失，不再标记为在线: %v", wanIface, acct.Username, err))
+        _ = s.Sessions.Fail(dbCtx, sid, "", fmt.Sprintf("lease lost: %v", err))
+        return err
+    }
+    _ = s.Accounts.Transition(dbCtx, acct.ID, models.StateOnline)
+    _ = s.Accounts.MarkUsedNow(dbCtx, acct.ID)
+    _ = s.Sessions.Succeed(dbCtx, sid)
+    _ = s.Sessions.EndIface(dbCtx, wanIface, sid)
+    s.report(ctx, fmt.Sprintf("%s 接口登录成功！", wanIface))
 
     // Apply weight based on bandwidth
-    w := weights.FromBandwidth(acct.Bandwidth)
-    s.Hub.Broadcast(fmt.Sprintf("配置已更新为权重 %d，正在重启 mwan3 服务...", w))
+    w := weights.FromBandwidth(int(acct.Bandwidth))
+    s.report(ctx, fmt.Sprintf("配置已更新为权重 %d，正在重启 mwan3 服务...", w))
     if err := s.MWAN.ApplyWeight(wanIface, w); err != nil {
-        s.Hub.Broadcast(fmt.Sprintf("mwan3 应用权重失败并已回滚: %v", err))
-        return
+        s.report(ctx, fmt.Sprintf("mwan3 应用权重失败并已回滚: %v", err))
+        _ = s.Sessions.Note(dbCtx, sid, fmt.Sprintf("apply weight: %v", err))
+        return nil
     }
-    s.Hub.Broadcast("mwan3 已重启并生效")
+    _ = s.Sessions.SetWeight(dbCtx, sid, w)
+    s.report(ctx, "mwan3 已重启并生效")
+    return nil
+}
+
+// errNoLease is returned by LogoutIface when no account is leased to the interface.
+var errNoLease = errors.New("no account is leased to this interface")
+
+// handleLogout logs an interface off the portal: POST /api/logout?wan=wanb[&drain=1].
+// drain sets the interface's mwan3 weight afterwards so traffic moves to the other links.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    wanIface := r.URL.Query().Get("wan")
+    if wanIface == "" { http.Error(w, "wan query required", 400); return }
+    drain, err := queryInt(r.URL.Query(), "drain", 0)
+    if err != nil || drain < 0 || drain > 1000 { http.Error(w, "drain must be a weight between 0 (keep the weight) and 1000", 400); return }
+    acct, err := s.LogoutIface(r.Context(), wanIface, int(drain))
+    var busy *busyError
+    switch {
+    case errors.As(err, &busy):
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        _ = json.NewEncoder(w).Encode(s.logins.status(wanIface, busy.run))
+    case errors.Is(err, errNoLease), errors.Is(err, service.ErrIfaceNotMapped):
+        http.Error(w, err.Error(), 404)
+    case acct == nil && err != nil:
+        http.Error(w, err.Error(), 502)
+    case err != nil:
+        http.Error(w, err.Error(), 500)
+    default:
+        writeJSON(w, map[string]any{"ok": true, "account_id": acct.ID, "username": acct.Username})
+    }
+}
+
+// LogoutIface logs the account leased to wanIface off the portal, ends its session, releases the
+// lease and returns the account to IDLE. With drain > 0 the mwan3 weight is then set to drain.
+// A nil account with an error means the portal logout itself failed and nothing was changed.
+// It does not overlap a login of the interface: while one runs it fails with a *busyError, and
+// logins triggered during the logout are refused.
+func (s *Server) LogoutIface(ctx context.Context, wanIface string, drain int) (*models.Account, error) {
+    run, ok := s.logins.exclusive(wanIface, "logout")
+    if !ok { return nil, &busyError{run: run} }
+    defer s.logins.release(wanIface, run)
+    t, err := s.target(ctx, wanIface)
+    if err != nil { return nil, err }
+    lease, err := s.Accounts.LeaseFor(ctx, wanIface)
+    if err != nil { return nil, err }
+    if lease == nil { return nil, errNoLease }
+    acct, err := s.Accounts.Get(ctx, lease.AccountID)
+    if err != nil { return nil, err }
+
+    s.Hub.Broadcast(fmt.Sprintf("正在注销 %s 接口的账号 %s", wanIface, acct.Username))
+    lctx, cancel := context.WithTimeout(context.Background(), t.profile.Timeout)
+    lctx = login.WithOutput(lctx, func(line string) { s.Hub.Broadcast(fmt.Sprintf("[%s] %s", wanIface, line)) })
+    err = t.auth.Logout(lctx, t.nic, acct.Username, t.profile.Host, t.profile.Teaching(), t.ip)
+    cancel()
+    if err != nil {
+        s.Hub.Broadcast(fmt.Sprintf("%s 接口注销失败: %v", wanIface, err))
+        return nil, err
+    }
+
+    _ = s.Sessions.EndIface(ctx, wanIface, 0)
+    if err := s.Accounts.Release(ctx, acct.ID); err != nil { return acct, err }
+    if err := s.Accounts.Transition(ctx, acct.ID, models.StateIdle); err != nil { return acct, err }
+    s.Hub.Broadcast(fmt.Sprintf("%s 接口已注销，账号 %s 已释放", wanIface, acct.Username))
+
+    if drain > 0 {
+        s.Hub.Broadcast(fmt.Sprintf("正在将 %s 接口权重调整为 %d...", wanIface, drain))
+        if err := s.MWAN.ApplyWeight(wanIface, drain); err != nil {
+            s.Hub.Broadcast(fmt.Sprintf("mwan3 应用权重失败并已回滚: %v", err))
+            return acct, fmt.Errorf("logged out, but applying drain weight failed: %w", err)
+        }
+        s.Hub.Broadcast("mwan3 已重启并生效")
+    }
+    return acct, nil
+}
+
+func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    list, err := s.Accounts.Leases(r.Context())
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    type leaseView struct {
+        AccountID  int64  `json:"account_id"`
+        WanIface   string `json:"wan_iface"`
+        AcquiredAt int64  `json:"acquired_at"`
+        ExpiresAt  int64  `json:"expires_at"`
+    }
+    out := make([]leaseView, 0, len(list))
+    for _, l := range list { out = append(out, leaseView(l)) }
+    writeJSON(w, out)
 }
 
 func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,73 @@
+package api
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+type sessionView struct {
+    ID          int64  `json:"id"`
+    WanIface    string `json:"wan_iface"`
+    Nic         string `json:"nic"`
+    AccountID   int64  `json:"account_id"`
+    Username    string `json:"username"`
+    StartedAt   int64  `json:"started_at"`
+    EndedAt     int64  `json:"ended_at"`
+    DurationSec int64  `json:"duration_sec"`
+    Outcome     string `json:"outcome"`
+    Error       string `json:"error"`
+    ErrorKind   string `json:"error_kind,omitempty"`
+    Weight      int    `json:"weight"`
+    Output      string `json:"output,omitempty"`
+}
+
+// handleSessions lists login attempts and sessions, newest first.
+// Filters: wan, account_id, outcome, since, until (unix seconds); paging: page, page_size.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    q := r.URL.Query()
+    accountID, err1 := queryInt(q, "account_id", 0)
+    since, err2 := queryInt(q, "since", 0)
+    until, err3 := queryInt(q, "until", 0)
+    page, err4 := queryInt(q, "page", 1)
+    size, err5 := queryInt(q, "page_size", 50)
+    if err := errors.Join(err1, err2, err3, err4, err5); err != nil { http.Error(w, err.Error(), 400); return }
+    if page < 1 { page = 1 }
+    if size < 1 || size > 500 { size = 50 }
+
+    f := service.SessionFilter{
+        WanIface:  q.Get("wan"),
+        AccountID: accountID,
+        Outcome:   q.Get("outcome"),
+        Since:     since,
+        Until:     until,
+        Limit:     int(size),
+        Offset:    int((page - 1) * size),
+    }
+    list, total, err := s.Sessions.List(r.Context(), f)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    items := make([]sessionView, 0, len(list))
+    for i := range list {
+        x := &list[i]
+        items = append(items, sessionView{
+            ID: x.ID, WanIface: x.WanIface, Nic: x.Nic, AccountID: x.AccountID, Username: x.Username,
+            StartedAt: x.StartedAt, EndedAt: x.EndedAt, DurationSec: int64(x.Duration().Seconds()),
+            Outcome: x.Outcome, Error: x.Error, ErrorKind: x.ErrorKind, Weight: x.Weight, Output: x.Output,
+        })
+    }
+    writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": size})
+}
+
+// queryInt parses a non-negative integer query parameter, returning def when it is absent.
+func queryInt(q url.Values, key string, def int64) (int64, error) {
+    v := q.Get(key)
+    if v == "" { return def, nil }
+    n, err := strconv.ParseInt(v, 10, 64)
+    if err != nil || n < 0 { return 0, fmt.Errorf("invalid %s", key) }
+    return n, nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+// handleSelectionSettings reads or replaces the account selection strategy settings.
+func (s *Server) handleSelectionSettings(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        cfg, err := s.Accounts.Selection.Settings(r.Context())
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]any{"settings": cfg, "strategies": service.Strategies()})
+    case http.MethodPut:
+        var cfg service.SelectionSettings
+        if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil { http.Error(w, err.Error(), 400); return }
+        if cfg.Default == "" { cfg.Default = service.StrategyLRU }
+        if err := s.Accounts.Selection.SetSettings(r.Context(), cfg); err != nil { writeError(w, err); return }
+        writeJSON(w, map[string]any{"ok": true})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+)
+
+// transferRow is the interchange format shared by import and export.
+type transferRow struct {
+    Username  string           `json:"username"`
+    Password  string           `json:"password,omitempty"`
+    Bandwidth models.Bandwidth `json:"bandwidth"`
+    Tags      []string         `json:"tags"`
+}
+
+type importResultView struct {
+    Row      int    `json:"row"`
+    Username string `json:"username"`
+    Action   string `json:"action"`
+    Error    string `json:"error,omitempty"`
+}
+
+// transferFormat picks csv or json from ?format=, falling back to the Content-Type header.
+func transferFormat(r *http.Request) string {
+    if f := strings.ToLower(r.URL.Query().Get("format")); f != "" { return f }
+    if strings.Contains(r.Header.Get("Content-Type"), "csv") { return "csv" }
+    return "json"
+}
+
+// handleAccountsImport accepts CSV (username,password,bandwidth[,tags]) or a JSON array and
+// returns a per-row report. ?mode=skip (default) or merge controls duplicate usernames.
+// A row without a tags column keeps the stored tags when merging.
+func (s *Server) handleAccountsImport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    mode := r.URL.Query().Get("mode")
+    if mode == "" { mode = service.ImportSkip }
+    body := http.MaxBytesReader(w, r.Body, 1<<20)
+    var rows []service.ImportRow
+    var report []importResultView
+    var err error
+    switch transferFormat(r) {
+    case "csv":
+        rows, report, err = parseImportCSV(body)
+    case "json":
+        rows, err = parseImportJSON(body)
+    default:
+        http.Error(w, "format must be csv or json", 400); return
+    }
+    if err != nil { http.Error(w, err.Error(), 400); return }
+    results, err := s.Accounts.Import(r.Context(), rows, mode)
+    if err != nil { writeError(w, err); return }
+    report = append([]importResultView{}, report...)
+    for _, x := range results { report = append(report, importResultView(x)) }
+    sort.Slice(report, func(i, j int) bool { return report[i].Row < report[j].Row })
+    counts := map[string]int{}
+    for _, x := range report { counts[x.Action]++ }
+    writeJSON(w, map[string]any{"summary": counts, "rows": report})
+}
+
+func parseImportJSON(r io.Reader) ([]service.ImportRow, error) {
+    var in []transferRow
+    if err := json.NewDecoder(r).Decode(&in); err != nil { return nil, err }
+    rows := make([]service.ImportRow, 0, len(in))
+    for i, x := range in {
+        rows = append(rows, service.ImportRow{Row: i + 1, Username: x.Username, Password: x.Password, Bandwidth: x.Bandwidth, Tags: x.Tags})
+    }
+    return rows, nil
+}
+
+// parseImportCSV reads records with an optional header row. Rows that cannot be parsed are
+// returned as error results so the report still covers every line.
+func parseImportCSV(r io.Reader) ([]service.ImportRow, []importResultView, error) {
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+    cr.TrimLeadingSpace = true
+    records, err := cr.ReadAll()
+    if err != nil { return nil, nil, err }
+    cols := map[string]int{"username": 0, "password": 1, "bandwidth": 2, "tags": 3}
+    start := 0
+    if len(records) > 0 && hasColumn(records[0], "username") {
+        cols = map[string]int{}
+        for i, name := range records[0] { cols[strings.ToLower(strings.TrimSpace(name))] = i }
+        start = 1
+    }
+    field := func(rec []string, name string) string {
+        i, ok := cols[name]
+        if !ok || i >= len(rec) { return "" }
+        return strings.TrimSpace(rec[i])
+    }
+    hasTags := func(rec []string) bool { i, ok := cols["tags"]; return ok && i < len(rec) }
+    var rows []service.ImportRow
+    var bad []importResultView
+    for n, rec := range records[start:] {
+        row := n + 1
+        username := field(rec, "username")
+        bw, err := parseBandwidth(field(rec, "bandwidth"))
+        if err != nil {
+            bad = append(bad, importResultView{Row: row, Username: username, Action: "error", Error: err.Error()})
+            continue
+        }
+        x := service.ImportRow{Row: row, Username: username, Password: field(rec, "password"), Bandwidth: bw}
+        if hasTags(rec) { x.Tags = strings.Split(field(rec, "tags"), ";") }
+        rows = append(rows, x)
+    }
+    return rows, bad, nil
+}
+
+func hasColumn(rec []string, name string) bool {
+    for _, v := range rec {
+        if strings.EqualFold(strings.TrimSpace(v), name) { return true }
+    }
+    return false
+}
+
+// parseBandwidth accepts "100" as well as "100M".
+func parseBandwidth(v string) (models.Bandwidth, error) {
+    n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(v, "M"), "m"))
+    if err != nil { return 0, fmt.Errorf("invalid bandwidth %q", v) }
+    return models.Bandwidth(n), nil
+}
+
+// handleAccountsExport writes every account as CSV or JSON. Passwords are redacted unless
+// ?redact=false is given, in which case the export is recorded in the audit log.
+func (s *Server) handleAccountsExport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    redact := true
+    if v := r.URL.Query().Get("redact"); v != "" {
+        b, err := strconv.ParseBool(v)
+        if err != nil { http.Error(w, "invalid redact value", 400); return }
+        redact = b
+    }
+    format := transferFormat(r)
+    if format != "csv" && format != "json" { http.Error(w, "format must be csv or json", 400); return }
+    list, err := s.Accounts.List(r.Context())
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    out := make([]transferRow, 0, len(list))
+    for i := range list {
+        row := transferRow{Username: list[i].Username, Bandwidth: list[i].Bandwidth, Tags: list[i].Tags}
+        if !redact {
+            if row.Password, err = s.Accounts.Password(&list[i]); err != nil { http.Error(w, err.Error(), 500); return }
+        }
+        out = append(out, row)
+    }
+    if !redact {
+        detail := fmt.Sprintf("%d accounts as %s", len(out), format)
+        if err := s.Audit.Record(r.Context(), "export_passwords", "accounts", clientAddr(r), detail); err != nil {
+            http.Error(w, "audit log unavailable: "+err.Error(), 500); return
+        }
+    }
+    w.Header().Set("Content-Disposition", "attachment; filename=accounts."+format)
+    if format == "json" { writeJSON(w, out); return }
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    cw := csv.NewWriter(w)
+    _ = cw.Write([]string{"username", "password", "bandwidth", "tags"})
+    for _, x := range out {
+        _ = cw.Write([]string{x.Username, x.Password, strconv.Itoa(int(x.Bandwidth)), strings.Join(x.Tags, ";")})
+    }
+    cw.Flush()
+}
@@ -3,20 +3,46 @@ package config
 import (
     "fmt"
     "os"
+    "path/filepath"
+    "strings"
 )
 
 type Config struct {
-    ListenAddr   string
-    DBPath       string
-    SSHHost      string
-    SSHPort      int
-    SSHUser      string
-    SSHPassword  string
-    SSHKeyPath   string
-    SZULoginPath string
-    MonitorURLs  []string
-    MonitorEvery int // seconds
-    WebDir       string
+    ListenAddr    string
+    DBPath        string
+    SSHHost       string
+    SSHPort       int
+    SSHUser       string
+    SSHPassword   string
+    SSHKeyPath    string
+    SZULoginPath  string
+    LoginBackend  string // default authenticator: exec, srun (built-in SRUN client), script or mock
+    LoginScript   string // program run by the "script" authenticator
+    SrunHost      string
+    SrunACID      string
+    MonitorURLs   []string
+    MonitorEvery  int // seconds
+    MonitorMode   string // where interfaces are probed: local (bound to the NIC) or router (mwan3 use)
+    // captive portal detection: portal hosts and page fingerprints that mark an HTTP probe
+    // answer as "needs login"
+    PortalHosts   []string
+    PortalMarks   []string // monitor.DefaultFingerprints when empty
+    // failover hysteresis and flap protection, see monitor.Config
+    FailAfter     int
+    RecoverAfter  int
+    MinFailover   int // seconds
+    MaxFailovers  int // per interface and hour; 0 = unlimited
+    WebDir        string
+    MasterKey     string // NM_MASTER_KEY, takes precedence over the key file
+    MasterKeyFile string
+    LeaseTTL      int // seconds an account stays leased to an interface after a successful login
+    // account health: consecutive failures before FAILED, and the cooldown range (seconds)
+    FailThreshold int
+    Cooldown      int
+    CooldownMax   int
+    // failover retries: accounts tried per failover and the initial backoff between them (seconds)
+    LoginAttempts int
+    RetryBackoff  int
 }
 
 func Load() *Config {
@@ -27,6 +53,10 @@ func Load() *Config {
         SSHUser:      getEnv("NM_SSH_USER", "root"),
         SZULoginPath: getEnv("NM_SZU_LOGIN", "/usr/local/bin/srun-login"),
     }
+    cfg.LoginBackend = getEnv("NM_LOGIN_BACKEND", "exec")
+    cfg.LoginScript = getEnv("NM_LOGIN_SCRIPT", "")
+    cfg.SrunHost = getEnv("NM_SRUN_HOST", "")
+    cfg.SrunACID = getEnv("NM_SRUN_ACID", "")
     // default port 22
     cfg.SSHPort = 22
     if v := os.Getenv("NM_SSH_PORT"); v != "" {
@@ -48,7 +78,8 @@ func Load() *Config {
     }
     urls := os.Getenv("NM_MONITOR_URLS")
     if urls == "" {
-        cfg.MonitorURLs = []string{"https://www.baidu.com", "https://www.qq.com"}
+        // plain http, so a captive portal's redirect can be seen instead of a TLS error
+        cfg.MonitorURLs = []string{"http://connect.rom.miui.com/generate_204", "http://www.baidu.com"}
     } else {
         // split by comma
         var out []string
@@ -62,8 +93,27 @@ func Load() *Config {
         if cur != "" { out = append(out, cur) }
         cfg.MonitorURLs = out
     }
+    cfg.MonitorMode = getEnv("NM_MONITOR_MODE", "local")
+    cfg.PortalHosts = splitList(getEnv("NM_PORTAL_HOSTS", "net.szu.edu.cn"))
+    if cfg.SrunHost != "" { cfg.PortalHosts = append(cfg.PortalHosts, cfg.SrunHost) }
+    // empty means monitor.DefaultFingerprints
+    cfg.PortalMarks = splitList(os.Getenv("NM_PORTAL_FINGERPRINTS"))
+    cfg.FailAfter = getEnvInt("NM_MONITOR_FAIL_THRESHOLD", 3)
+    cfg.RecoverAfter = getEnvInt("NM_MONITOR_RECOVER_THRESHOLD", 2)
+    cfg.MinFailover = getEnvCount("NM_MONITOR_MIN_FAILOVER_INTERVAL", 120)
+    cfg.MaxFailovers = getEnvCount("NM_MONITOR_MAX_FAILOVERS_PER_HOUR", 4)
     // web dir (for embedded SPA)
     cfg.WebDir = getEnv("NM_WEB_DIR", "web/dist")
+    // account lease and health
+    cfg.LeaseTTL = getEnvInt("NM_LEASE_TTL", 86400)
+    cfg.FailThreshold = getEnvInt("NM_ACCOUNT_FAIL_THRESHOLD", 3)
+    cfg.Cooldown = getEnvInt("NM_ACCOUNT_COOLDOWN", 300)
+    cfg.CooldownMax = getEnvInt("NM_ACCOUNT_COOLDOWN_MAX", 6*3600)
+    cfg.LoginAttempts = getEnvInt("NM_LOGIN_MAX_ACCOUNTS", 3)
+    cfg.RetryBackoff = getEnvInt("NM_LOGIN_RETRY_BACKOFF", 5)
+    // master key for account passwords; the default key file lives next to the DB but is not part of backups
+    cfg.MasterKey = os.Getenv("NM_MASTER_KEY")
+    cfg.MasterKeyFile = getEnv("NM_MASTER_KEY_FILE", filepath.Join(filepath.Dir(cfg.DBPath), "master.key"))
     return cfg
 }
 
@@ -73,3 +123,26 @@ func getEnv(key, def string) string {
     }
     return def
 }
+
+// getEnvInt returns a positive integer from the environment, or def when unset or invalid.
+func getEnvInt(key string, def int) int {
+    var n int
+    if _, err := fmt.Sscanf(os.Getenv(key), "%d", &n); err != nil || n <= 0 { return def }
+    return n
+}
+
+// getEnvCount is getEnvInt for settings where 0 is meaningful (e.g. "no limit").
+func getEnvCount(key string, def int) int {
+    var n int
+    if _, err := fmt.Sscanf(os.Getenv(key), "%d", &n); err != nil || n < 0 { return def }
+    return n
+}
+
+// splitList splits a comma separated setting, dropping empty items.
+func splitList(v string) []string {
+    var out []string
+    for _, x := range strings.Split(v, ",") {
+        if x = strings.TrimSpace(x); x != "" { out = append(out, x) }
+    }
+    return out
+}
@@ -2,13 +2,18 @@ package db
 
 import (
     "database/sql"
+    "fmt"
+    "path/filepath"
+
     _ "github.com/ncruces/go-sqlite3/driver"
     // Embed the SQLite WASM binary so the driver can load automatically.
     _ "github.com/ncruces/go-sqlite3/embed"
 )
 
+// Open opens the database with immediate transactions and a busy timeout so that concurrent
+// writers (e.g. two interfaces claiming accounts) wait for each other instead of failing.
 func Open(path string) (*sql.DB, error) {
-    return sql.Open("sqlite3", path)
+    return sql.Open("sqlite3", "file:"+filepath.ToSlash(path)+"?_txlock=immediate&_pragma=busy_timeout(5000)")
 }
 
 func Migrate(db *sql.DB) error {
@@ -32,9 +37,81 @@ func Migrate(db *sql.DB) error {
             k TEXT PRIMARY KEY,
             v TEXT NOT NULL
         );`,
+        `CREATE TABLE IF NOT EXISTS account_leases (
+            account_id INTEGER PRIMARY KEY,
+            wan_iface TEXT NOT NULL,
+            acquired_at INTEGER NOT NULL,
+            expires_at INTEGER NOT NULL
+        );`,
+        `CREATE UNIQUE INDEX IF NOT EXISTS idx_account_leases_wan ON account_leases(wan_iface);`,
+        `CREATE TABLE IF NOT EXISTS sessions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            wan_iface TEXT NOT NULL,
+            nic TEXT NOT NULL DEFAULT '',
+            account_id INTEGER NOT NULL DEFAULT 0,
+            username TEXT NOT NULL DEFAULT '',
+            started_at INTEGER NOT NULL,
+            ended_at INTEGER NOT NULL DEFAULT 0,
+            outcome TEXT NOT NULL DEFAULT 'pending',
+            error TEXT NOT NULL DEFAULT '',
+            weight INTEGER NOT NULL DEFAULT 0
+        );`,
+        `CREATE INDEX IF NOT EXISTS idx_sessions_wan ON sessions(wan_iface, started_at);`,
+        `CREATE INDEX IF NOT EXISTS idx_sessions_account ON sessions(account_id, started_at);`,
+        `CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            at INTEGER NOT NULL,
+            action TEXT NOT NULL,
+            target TEXT NOT NULL DEFAULT '',
+            remote TEXT NOT NULL DEFAULT '',
+            detail TEXT NOT NULL DEFAULT ''
+        );`,
+        `CREATE TABLE IF NOT EXISTS login_profiles (
+            wan_iface TEXT PRIMARY KEY,
+            authenticator TEXT NOT NULL DEFAULT ''
+        );`,
     }
     for _, s := range stmts {
         if _, err := db.Exec(s); err != nil { return err }
     }
-    return nil
+    // Columns added after the first release; ALTER TABLE keeps existing databases usable.
+    columns := []struct{ table, name, def string }{
+        {"accounts", "fail_count", "INTEGER NOT NULL DEFAULT 0"},
+        {"accounts", "cooldown_until", "INTEGER NOT NULL DEFAULT 0"},
+        {"accounts", "tags", "TEXT NOT NULL DEFAULT ''"},
+        {"iface_map", "pool_tags", "TEXT NOT NULL DEFAULT ''"},
+        {"iface_map", "pool_fallback", "INTEGER NOT NULL DEFAULT 0"},
+        {"sessions", "output", "TEXT NOT NULL DEFAULT ''"},
+        {"sessions", "error_kind", "TEXT NOT NULL DEFAULT ''"},
+        {"login_profiles", "host", "TEXT NOT NULL DEFAULT ''"},
+        {"login_profiles", "area", "TEXT NOT NULL DEFAULT 'teaching'"},
+        {"login_profiles", "bind_ip", "TEXT NOT NULL DEFAULT ''"},
+        {"login_profiles", "timeout_sec", "INTEGER NOT NULL DEFAULT 0"},
+        {"login_profiles", "retries", "INTEGER NOT NULL DEFAULT 0"},
+    }
+    for _, c := range columns {
+        if err := addColumn(db, c.table, c.name, c.def); err != nil { return err }
+    }
+    if err := dedupUsernames(db); err != nil { return fmt.Errorf("dedup usernames: %w", err) }
+    _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_username ON accounts(username);`)
+    return err
+}
+
+// dedupUsernames makes usernames unique before the index on them is created. Databases from
+// before the index may hold the same username twice; the oldest row keeps it and the others are
+// renamed to "username#id" and disabled, so nothing is lost and an admin can delete them.
+func dedupUsernames(db *sql.DB) error {
+    _, err := db.Exec(`UPDATE accounts SET username=username || '#' || id, disabled=1,
+            status=CASE WHEN status IN ('ONLINE', 'CONNECTING') THEN status ELSE 'DISABLED' END
+        WHERE id NOT IN (SELECT MIN(id) FROM accounts GROUP BY username)`)
+    return err
+}
+
+// addColumn adds table.name unless it already exists.
+func addColumn(db *sql.DB, table, name, def string) error {
+    var n int
+    if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?`, table, name).Scan(&n); err != nil { return err }
+    if n > 0 { return nil }
+    _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, name, def))
+    return err
 }
@@ -0,0 +1,37 @@
+package db
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+// A database from before the username index keeps its oldest row per username; later copies are
+// renamed and disabled.
+func TestMigrateDedupsUsernames(t *testing.T) {
+    database, err := Open(filepath.Join(t.TempDir(), "old.db"))
+    if err != nil { t.Fatal(err) }
+    defer database.Close()
+    if _, err := database.Exec(`CREATE TABLE accounts (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL, password TEXT NOT NULL,
+        bandwidth INTEGER NOT NULL DEFAULT 50, status TEXT NOT NULL DEFAULT 'IDLE', last_used_at INTEGER NOT NULL DEFAULT 0, disabled INTEGER NOT NULL DEFAULT 0)`); err != nil { t.Fatal(err) }
+    if _, err := database.Exec(`INSERT INTO accounts (username, password, status) VALUES ('a', 'p', 'IDLE'), ('b', 'p', 'IDLE'), ('a', 'p', 'IDLE'), ('a', 'p', 'ONLINE')`); err != nil { t.Fatal(err) }
+
+    if err := Migrate(database); err != nil { t.Fatal(err) }
+    if err := Migrate(database); err != nil { t.Fatalf("second migrate: %v", err) }
+
+    want := map[int64]struct {
+        username, status string
+        disabled         int
+    }{1: {"a", "IDLE", 0}, 2: {"b", "IDLE", 0}, 3: {"a#3", "DISABLED", 1}, 4: {"a#4", "ONLINE", 1}}
+    rows, err := database.Query(`SELECT id, username, status, disabled FROM accounts`)
+    if err != nil { t.Fatal(err) }
+    defer rows.Close()
+    for rows.Next() {
+        var id int64
+        var username, status string
+        var disabled int
+        if err := rows.Scan(&id, &username, &status, &disabled); err != nil { t.Fatal(err) }
+        w := want[id]
+        if username != w.username || status != w.status || disabled != w.disabled { t.Errorf("account %d = %s %s %d, want %+v", id, username, status, disabled, w) }
+    }
+    if _, err := database.Exec(`INSERT INTO accounts (username, password) VALUES ('b', 'p')`); err == nil { t.Fatal("duplicate username inserted after migrate") }
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "sync"
+    "time"
+)
+
+// Job states.
+const (
+    StateRunning   = "running"
+    StateSucceeded = "succeeded"
+    StateFailed    = "failed"
+    StateCancelled = "cancelled"
+)
+
+// keep bounds how many finished jobs are remembered.
+const keep = 200
+
+type Step struct {
+    At      time.Time
+    Message string
+}
+
+// Job is a snapshot of a background task.
+type Job struct {
+    ID         string
+    Kind       string // e.g. "login"
+    Target     string // e.g. the WAN interface
+    State      string
+    Steps      []Step
+    Error      string
+    CreatedAt  time.Time
+    FinishedAt time.Time // zero while running
+}
+
+type job struct {
+    Job
+    cancel context.CancelFunc
+}
+
+// Manager runs jobs under a context that lives as long as the server, not the request that
+// started them.
+type Manager struct {
+    ctx   context.Context
+    mu    sync.Mutex
+    jobs  map[string]*job
+    order []string // creation order, oldest first
+}
+
+func New(ctx context.Context) *Manager { return &Manager{ctx: ctx, jobs: map[string]*job{}} }
+
+type ctxKey struct{}
+
+// Start runs fn in the background and returns the new job's ID. fn reports progress with Report
+// on the context it receives; its error decides the final state, which is cancelled only when fn
+// returns the context's error after Cancel.
+func (m *Manager) Start(kind, target string, fn func(ctx context.Context) error) string {
+    ctx, cancel := context.WithCancel(m.ctx)
+    j := &job{Job: Job{ID: newID(), Kind: kind, Target: target, State: StateRunning, CreatedAt: time.Now()}, cancel: cancel}
+    m.mu.Lock()
+    m.jobs[j.ID] = j
+    m.order = append(m.order, j.ID)
+    m.prune()
+    m.mu.Unlock()
+
+    go func() {
+        defer cancel()
+        err := fn(context.WithValue(ctx, ctxKey{}, &ref{m: m, id: j.ID}))
+        // decided under the lock Cancel takes; a job that finished on its own despite a late
+        // Cancel keeps its real outcome
+        m.mu.Lock(); defer m.mu.Unlock()
+        j.FinishedAt = time.Now()
+        switch {
+        case err != nil && errors.Is(err, ctx.Err()) && m.ctx.Err() == nil:
+            j.State = StateCancelled
+            j.Error = "cancelled"
+        case err != nil:
+            j.State, j.Error = StateFailed, err.Error()
+        default:
+            j.State = StateSucceeded
+        }
+    }()
+    return j.ID
+}
+
+// Get returns a copy of the job.
+func (m *Manager) Get(id string) (Job, bool) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    j, ok := m.jobs[id]
+    if !ok { return Job{}, false }
+    return j.snapshot(), true
+}
+
+// List returns the remembered jobs, newest first.
+func (m *Manager) List() []Job {
+    m.mu.Lock(); defer m.mu.Unlock()
+    out := make([]Job, 0, len(m.order))
+    for i := len(m.order) - 1; i >= 0; i-- { out = append(out, m.jobs[m.order[i]].snapshot()) }
+    return out
+}
+
+// Cancel asks a running job to stop. It reports false for unknown or finished jobs.
+func (m *Manager) Cancel(id string) bool {
+    m.mu.Lock(); defer m.mu.Unlock()
+    j, ok := m.jobs[id]
+    if !ok || j.State != StateRunning { return false }
+    j.cancel()
+    return true
+}
+
+// prune forgets the oldest finished jobs beyond keep; callers hold m.mu.
+func (m *Manager) prune() {
+    for i := 0; len(m.order) > keep && i < len(m.order); {
+        if j := m.jobs[m.order[i]]; j.State != StateRunning {
+            delete(m.jobs, j.ID)
+            m.order = append(m.order[:i], m.order[i+1:]...)
+            continue
+        }
+        i++
+    }
+}
+
+func (j *job) snapshot() Job {
+    x := j.Job
+    x.Steps = append([]Step(nil), j.Steps...)
+    return x
+}
+
+type ref struct {
+    m  *Manager
+    id string
+}
+
+// Report records a progress message on the job running under ctx, if any.
+func Report(ctx context.Context, msg string) {
+    r, ok := ctx.Value(ctxKey{}).(*ref)
+    if !ok { return }
+    r.m.mu.Lock(); defer r.m.mu.Unlock()
+    if j, ok := r.m.jobs[r.id]; ok { j.Steps = append(j.Steps, Step{At: time.Now(), Message: msg}) }
+}
+
+func newID() string {
+    b := make([]byte, 8)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
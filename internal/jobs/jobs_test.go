@@ -0,0 +1,45 @@
+package jobs
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func wait(t *testing.T, m *Manager, id string) Job {
+    t.Helper()
+    for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+        if j, _ := m.Get(id); j.State != StateRunning { return j }
+    }
+    t.Fatalf("job %s still running", id)
+    return Job{}
+}
+
+func TestCancelOutcome(t *testing.T) {
+    m := New(context.Background())
+    cases := []struct {
+        name  string
+        ret   func(ctx context.Context) error
+        state string
+    }{
+        {"stopped", func(ctx context.Context) error { return ctx.Err() }, StateCancelled},
+        {"wrapped", func(ctx context.Context) error { return errors.Join(errors.New("login"), ctx.Err()) }, StateCancelled},
+        {"finished anyway", func(ctx context.Context) error { return nil }, StateSucceeded},
+        {"failed anyway", func(ctx context.Context) error { return errors.New("portal unreachable") }, StateFailed},
+    }
+    for _, c := range cases {
+        started, cancelled := make(chan struct{}), make(chan struct{})
+        id := m.Start("test", c.name, func(ctx context.Context) error {
+            close(started)
+            <-cancelled
+            <-ctx.Done()
+            return c.ret(ctx)
+        })
+        <-started
+        if !m.Cancel(id) { t.Fatalf("%s: cancel refused", c.name) }
+        close(cancelled)
+        if j := wait(t, m, id); j.State != c.state { t.Errorf("%s: state = %s, want %s", c.name, j.State, c.state) }
+        if m.Cancel(id) { t.Errorf("%s: cancelled a finished job", c.name) }
+    }
+}
@@ -0,0 +1,44 @@
+package login
+
+import (
+    "context"
+    "sort"
+    "sync"
+)
+
+// Authenticator performs portal logins and logouts that leave through iface.
+type Authenticator interface {
+    Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error
+    Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error
+}
+
+// Registry holds the authenticators available to login profiles, by name.
+type Registry struct {
+    mu      sync.RWMutex
+    m       map[string]Authenticator
+    Default string // used when a profile does not name one
+}
+
+func NewRegistry() *Registry { return &Registry{m: map[string]Authenticator{}} }
+
+func (r *Registry) Register(name string, a Authenticator) {
+    r.mu.Lock(); defer r.mu.Unlock()
+    r.m[name] = a
+}
+
+// Get returns the authenticator called name, or the default one for an empty name.
+func (r *Registry) Get(name string) (Authenticator, bool) {
+    r.mu.RLock(); defer r.mu.RUnlock()
+    if name == "" { name = r.Default }
+    a, ok := r.m[name]
+    return a, ok
+}
+
+// Names lists the registered authenticators in sorted order.
+func (r *Registry) Names() []string {
+    r.mu.RLock(); defer r.mu.RUnlock()
+    out := make([]string, 0, len(r.m))
+    for name := range r.m { out = append(out, name) }
+    sort.Strings(out)
+    return out
+}
@@ -0,0 +1,113 @@
+package login
+
+import (
+    "context"
+    "errors"
+    "net"
+    "strings"
+)
+
+// Kind classifies why a login failed.
+type Kind string
+
+const (
+    KindWrongPassword Kind = "wrong_password"
+    KindArrears       Kind = "arrears"
+    KindDeviceLimit   Kind = "device_limit"
+    KindUnreachable   Kind = "unreachable"
+    KindTimeout       Kind = "timeout"
+    KindRejected      Kind = "rejected" // the portal refused the login for a reason not listed above
+    KindUnknown       Kind = "unknown"
+)
+
+// Error is a classified login failure. Msg is the portal or tool message that matched.
+type Error struct {
+    Kind Kind
+    Msg  string
+    Err  error
+}
+
+func (e *Error) Error() string {
+    s := string(e.Kind)
+    if e.Msg != "" { s += ": " + e.Msg }
+    if e.Err != nil && (e.Msg == "" || !strings.Contains(e.Msg, e.Err.Error())) { s += " (" + e.Err.Error() + ")" }
+    return s
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// KindOf returns the classification of err, KindUnknown for unclassified errors.
+func KindOf(err error) Kind {
+    var le *Error
+    if errors.As(err, &le) { return le.Kind }
+    return KindUnknown
+}
+
+// AccountFault reports whether err is the portal's verdict on the account, so retrying with
+// another account may succeed. Everything else (unreachable portals, timeouts, a missing login
+// tool, unsupported settings) would fail for every account alike.
+func AccountFault(err error) bool {
+    switch KindOf(err) {
+    case KindWrongPassword, KindArrears, KindDeviceLimit, KindRejected:
+        return true
+    }
+    return false
+}
+
+// Transient reports whether err may go away when the same login is simply tried again.
+func Transient(err error) bool {
+    k := KindOf(err)
+    return k == KindUnreachable || k == KindTimeout
+}
+
+// Permanent reports whether the account will keep failing until someone fixes it
+// (wrong password, unpaid balance), as opposed to a transient condition.
+func Permanent(err error) bool {
+    k := KindOf(err)
+    return k == KindWrongPassword || k == KindArrears
+}
+
+// patterns maps known SRUN error codes and srun-login messages (lower-cased) to kinds.
+var patterns = []struct {
+    kind  Kind
+    match []string
+}{
+    {KindWrongPassword, []string{"e2901", "e2553", "e2531", "password is error", "wrong password", "incorrect password", "user not found", "密码错误", "用户不存在"}},
+    {KindArrears, []string{"e2616", "e3004", "arrearage", "arrears", "欠费", "余额不足"}},
+    {KindDeviceLimit, []string{"e2620", "online_num", "online limit", "too many online", "在线数", "登录人数"}},
+    {KindTimeout, []string{"timed out", "timeout", "deadline exceeded", "超时"}},
+    {KindUnreachable, []string{"connection refused", "no route to host", "network is unreachable", "no such host", "connection reset", "couldn't connect", "could not resolve", "无法连接"}},
+}
+
+// Rejected classifies a login refused by the portal; unrecognised messages become KindRejected.
+func Rejected(output string, err error) *Error {
+    e := Classify(output, err)
+    if e.Kind == KindUnknown { e.Kind = KindRejected }
+    return e
+}
+
+// Classify turns the output of a failed login and its error into an *Error. The last line of
+// output that matches a known message wins, since tools print the final verdict last.
+func Classify(output string, err error) *Error {
+    if errors.Is(err, context.DeadlineExceeded) { return &Error{Kind: KindTimeout, Err: err} }
+    out := strings.Split(strings.TrimSpace(output), "\n")
+    lines := out
+    if err != nil { lines = append(append([]string{}, out...), err.Error()) }
+    for i := len(lines) - 1; i >= 0; i-- {
+        line := strings.TrimSpace(lines[i])
+        lower := strings.ToLower(line)
+        for _, p := range patterns {
+            for _, m := range p.match {
+                if strings.Contains(lower, m) { return &Error{Kind: p.kind, Msg: line, Err: err} }
+            }
+        }
+    }
+    var ne net.Error
+    if errors.As(err, &ne) {
+        if ne.Timeout() { return &Error{Kind: KindTimeout, Err: err} }
+        return &Error{Kind: KindUnreachable, Err: err}
+    }
+    msg := ""
+    for i := len(out) - 1; i >= 0 && msg == ""; i-- { msg = strings.TrimSpace(out[i]) }
+    return &Error{Kind: KindUnknown, Msg: msg, Err: err}
+}
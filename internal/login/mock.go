@@ -0,0 +1,29 @@
+package login
+
+import (
+    "context"
+    "sync"
+)
+
+// Mock is the "mock" authenticator for tests and demos. It never touches the network: every
+// call is recorded and returns Err (nil means success).
+type Mock struct {
+    mu      sync.Mutex
+    Err     error
+    Logins  []string // "iface/username" per Login call
+    Logouts []string
+}
+
+func (m *Mock) Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error {
+    m.mu.Lock(); defer m.mu.Unlock()
+    m.Logins = append(m.Logins, iface+"/"+username)
+    outputFunc(ctx)("mock: login " + username + " on " + iface)
+    return m.Err
+}
+
+func (m *Mock) Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error {
+    m.mu.Lock(); defer m.mu.Unlock()
+    m.Logouts = append(m.Logouts, iface+"/"+username)
+    outputFunc(ctx)("mock: logout " + username + " on " + iface)
+    return m.Err
+}
@@ -0,0 +1,61 @@
+package login
+
+import (
+    "bytes"
+    "context"
+    "strings"
+    "sync"
+)
+
+type outputKey struct{}
+
+// WithOutput returns a context whose logins report every line of output to fn as it arrives.
+func WithOutput(ctx context.Context, fn func(line string)) context.Context {
+    return context.WithValue(ctx, outputKey{}, fn)
+}
+
+func outputFunc(ctx context.Context) func(string) {
+    if fn, ok := ctx.Value(outputKey{}).(func(string)); ok && fn != nil { return fn }
+    return func(string) {}
+}
+
+// maxOutput caps how much output a lineWriter keeps for classification.
+const maxOutput = 64 << 10
+
+// lineWriter splits written bytes into lines, forwards each one and keeps a bounded copy.
+type lineWriter struct {
+    mu      sync.Mutex
+    emit    func(string)
+    partial []byte
+    kept    strings.Builder
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+    w.mu.Lock(); defer w.mu.Unlock()
+    w.partial = append(w.partial, p...)
+    for {
+        i := bytes.IndexByte(w.partial, '\n')
+        if i < 0 { break }
+        w.line(string(w.partial[:i]))
+        w.partial = w.partial[i+1:]
+    }
+    return len(p), nil
+}
+
+// Flush emits a trailing line that was not terminated by a newline.
+func (w *lineWriter) Flush() {
+    w.mu.Lock(); defer w.mu.Unlock()
+    if len(w.partial) > 0 { w.line(string(w.partial)); w.partial = nil }
+}
+
+func (w *lineWriter) line(s string) {
+    s = strings.TrimRight(s, "\r")
+    if strings.TrimSpace(s) == "" { return }
+    w.emit(s)
+    if w.kept.Len()+len(s) < maxOutput { w.kept.WriteString(s); w.kept.WriteByte('\n') }
+}
+
+func (w *lineWriter) String() string {
+    w.mu.Lock(); defer w.mu.Unlock()
+    return w.kept.String()
+}
@@ -0,0 +1,77 @@
+package login
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "strconv"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/sshqueue"
+)
+
+// PortalStatus is what the portal reports for the address a query comes from.
+type PortalStatus struct {
+    Online      bool
+    Username    string
+    IP          string
+    LoginAt     time.Time     // zero when offline
+    SessionTime time.Duration // since LoginAt
+    UsedBytes   int64         // traffic used in the current billing period
+    BytesIn     int64
+    BytesOut    int64
+}
+
+// Status asks the portal (rad_user_info) who is online on iface.
+func (s *Srun) Status(ctx context.Context, iface, host string) (*PortalStatus, error) {
+    base := s.base(host)
+    client := s.httpClient(iface)
+    var raw map[string]any
+    if err := srunGet(ctx, client, base+"/cgi-bin/rad_user_info", url.Values{}, &raw); err != nil { return nil, Classify("", fmt.Errorf("srun status: %w", err)) }
+    return parsePortalStatus(raw), nil
+}
+
+// StatusOnRouter asks the portal from the router, under `mwan3 use <wanIface>`, so the answer is
+// about that WAN's address. exec runs a shell command there; sshqueue.Queue.Exec fits.
+func (s *Srun) StatusOnRouter(exec func(cmd string) (string, error), wanIface, host string, timeout time.Duration) (*PortalStatus, error) {
+    secs := int(timeout.Seconds())
+    if secs < 1 { secs = 1 }
+    endpoint := s.base(host) + "/cgi-bin/rad_user_info?callback=jsonp"
+    out, err := exec(fmt.Sprintf("mwan3 use %s curl -s -m %d %s", sshqueue.Quote(wanIface), secs, sshqueue.Quote(endpoint)))
+    if err != nil { return nil, Classify("", fmt.Errorf("srun status: %w", err)) }
+    var raw map[string]any
+    if err := unwrapJSONP(out, &raw); err != nil { return nil, Classify("", fmt.Errorf("srun status: %w", err)) }
+    return parsePortalStatus(raw), nil
+}
+
+// parsePortalStatus reads a rad_user_info answer.
+func parsePortalStatus(raw map[string]any) *PortalStatus {
+    st := &PortalStatus{}
+    if e, _ := raw["error"].(string); e != "ok" {
+        st.IP, _ = raw["client_ip"].(string)
+        return st
+    }
+    st.Online = true
+    st.Username, _ = raw["user_name"].(string)
+    st.IP, _ = raw["online_ip"].(string)
+    if t := portalInt(raw["add_time"]); t > 0 {
+        st.LoginAt = time.Unix(t, 0)
+        st.SessionTime = time.Since(st.LoginAt).Truncate(time.Second)
+    }
+    st.UsedBytes = portalInt(raw["sum_bytes"])
+    st.BytesIn = portalInt(raw["bytes_in"])
+    st.BytesOut = portalInt(raw["bytes_out"])
+    return st
+}
+
+// portalInt reads a counter the portal encodes either as a JSON number or as a string.
+func portalInt(v any) int64 {
+    switch x := v.(type) {
+    case float64:
+        return int64(x)
+    case string:
+        n, _ := strconv.ParseInt(x, 10, 64)
+        return n
+    }
+    return 0
+}
@@ -0,0 +1,90 @@
+package login
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// RemoteExec runs a shell command on the router, feeding it stdin; sshqueue.Queue implements it.
+type RemoteExec interface {
+    ExecInput(ctx context.Context, cmd string, stdin io.Reader, out io.Writer) error
+}
+
+// Remote is the "ssh" authenticator: it logs in with the SRUN client, but every portal request
+// runs on the router with curl bound to the WAN device (--interface), so the portal sees the
+// router's address rather than the host NetManager runs on.
+//
+// Requests carry the credentials (the password hash and the encrypted info), so they reach curl
+// as a config on stdin (`curl -K -`): nothing secret appears in a command line on the router,
+// where any user could read it with ps. Like Srun, only the teaching area portal is supported.
+type Remote struct {
+    Exec RemoteExec
+    Srun Srun // portal settings; its Client is replaced by one that runs on the router
+}
+
+func (r *Remote) Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error {
+    return r.srun().Login(ctx, iface, username, password, host, teaching, ip)
+}
+
+func (r *Remote) Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error {
+    return r.srun().Logout(ctx, iface, username, host, teaching, ip)
+}
+
+func (r *Remote) srun() *Srun {
+    s := r.Srun
+    s.Client = func(iface string) *http.Client { return &http.Client{Transport: &routerTransport{exec: r.Exec, iface: iface}} }
+    return &s
+}
+
+// routerTransport performs GET requests with curl on the router. curl follows redirects itself;
+// the response's Request carries the final URL.
+type routerTransport struct {
+    exec  RemoteExec
+    iface string
+}
+
+func (t *routerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    if req.Method != http.MethodGet { return nil, fmt.Errorf("router transport: %s not supported", req.Method) }
+    secs := 10
+    if d, ok := req.Context().Deadline(); ok { secs = max(1, int(time.Until(d).Seconds())) }
+    var cfg strings.Builder
+    fmt.Fprintf(&cfg, "url = %s\n", curlQuote(req.URL.String()))
+    if t.iface != "" { fmt.Fprintf(&cfg, "interface = %s\n", curlQuote(t.iface)) }
+    fmt.Fprintf(&cfg, "max-time = %d\nsilent\nshow-error\nlocation\n", secs)
+    // the status and final URL go on a line of their own after the body
+    cfg.WriteString(`write-out = "\n%{http_code} %{url_effective}"` + "\n")
+
+    var out strings.Builder
+    if err := t.exec.ExecInput(req.Context(), "curl -K -", strings.NewReader(cfg.String()), &out); err != nil {
+        return nil, fmt.Errorf("curl on router: %w: %s", err, strings.TrimSpace(out.String()))
+    }
+    body, last := "", out.String()
+    if i := strings.LastIndexByte(last, '\n'); i >= 0 { body, last = last[:i], last[i+1:] }
+    status, effective, _ := strings.Cut(strings.TrimSpace(last), " ")
+    code, err := strconv.Atoi(status)
+    if err != nil || code == 0 { return nil, fmt.Errorf("curl on router: no response from %s", req.URL.Host) }
+
+    resp := &http.Response{
+        Status: fmt.Sprintf("%d %s", code, http.StatusText(code)), StatusCode: code,
+        Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+        Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), ContentLength: int64(len(body)),
+        Request: req,
+    }
+    if u, err := url.Parse(effective); err == nil && effective != "" && effective != req.URL.String() {
+        final := req.Clone(req.Context())
+        final.URL = u
+        resp.Request = final
+    }
+    return resp, nil
+}
+
+// curlQuote quotes s as a curl config value.
+func curlQuote(s string) string {
+    return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
@@ -0,0 +1,72 @@
+package login
+
+import (
+    "context"
+    "io"
+    "net/url"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// shellRouter stands in for sshqueue.Queue: it runs the commands with the local shell and
+// records them.
+type shellRouter struct {
+    mu   sync.Mutex
+    cmds []string
+}
+
+func (r *shellRouter) ExecInput(ctx context.Context, cmd string, stdin io.Reader, out io.Writer) error {
+    r.mu.Lock()
+    r.cmds = append(r.cmds, cmd)
+    r.mu.Unlock()
+    c := exec.CommandContext(ctx, "sh", "-c", cmd)
+    c.Stdin, c.Stdout, c.Stderr = stdin, out, out
+    return c.Run()
+}
+
+// newShellRemote returns a Remote against the fake portal, with a curl wrapper first in PATH
+// that logs every argument it is started with to the returned file.
+func newShellRemote(t *testing.T) (*Remote, *fakePortal, *shellRouter, string) {
+    if runtime.GOOS == "windows" { t.Skip("needs a POSIX shell") }
+    curl, err := exec.LookPath("curl")
+    if err != nil { t.Skip("curl unavailable") }
+    dir := t.TempDir()
+    argv := filepath.Join(dir, "argv")
+    wrapper := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\" >> '" + argv + "'; done\nexec '" + curl + "' \"$@\"\n"
+    if err := os.WriteFile(filepath.Join(dir, "curl"), []byte(wrapper), 0o755); err != nil { t.Fatal(err) }
+    t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+    f, s := newFakePortal(t)
+    router := &shellRouter{}
+    return &Remote{Exec: router, Srun: *s}, f, router, argv
+}
+
+func TestRemoteLogin(t *testing.T) {
+    r, f, router, argv := newShellRemote(t)
+
+    if err := r.Login(context.Background(), "", vecUser, vecPass, "", true, ""); err != nil { t.Fatalf("login: %v", err) }
+    if got := f.login.Get("password"); got != "{MD5}"+vecHMD5 { t.Errorf("portal got password %q", got) }
+    if err := r.Logout(context.Background(), "", vecUser, "", true, ""); err != nil { t.Fatalf("logout: %v", err) }
+
+    args, err := os.ReadFile(argv)
+    if err != nil { t.Fatal(err) }
+    if strings.TrimSpace(string(args)) != "-K\n-\n-K\n-\n-K\n-" { t.Errorf("curl arguments:\n%s", args) }
+    for _, secret := range []string{vecPass, vecHMD5, url.QueryEscape(vecInfo), vecUser} {
+        if strings.Contains(string(args), secret) { t.Errorf("%q in curl's arguments", secret) }
+        for _, c := range router.cmds {
+            if strings.Contains(c, secret) { t.Errorf("%q in router command %s", secret, c) }
+        }
+    }
+}
+
+func TestRemoteUnreachable(t *testing.T) {
+    r, _, _, _ := newShellRemote(t)
+    r.Srun.Host = "http://127.0.0.1:1"
+    err := r.Login(context.Background(), "", vecUser, vecPass, "", true, "")
+    if k := KindOf(err); k != KindUnreachable { t.Fatalf("kind = %s (%v), want %s", k, err, KindUnreachable) }
+}
@@ -7,27 +7,45 @@ import (
     "time"
 )
 
+// Runner is the "exec" authenticator: it shells out to the srun-login binary.
 type Runner struct {
     BinaryPath string
 }
 
 func (r *Runner) Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error {
-    if r.BinaryPath == "" { return fmt.Errorf("empty SZU-login binary path") }
-    // Build args
+    return r.run(ctx, append(loginArgs(iface, host, teaching, ip), "--username", username, "--password", password))
+}
+
+// Logout logs the account on iface off the portal.
+func (r *Runner) Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error {
+    return r.run(ctx, append(loginArgs(iface, host, teaching, ip), "--username", username, "--logout"))
+}
+
+// loginArgs builds the srun-login flags shared by login and logout.
+func loginArgs(iface, host string, teaching bool, ip string) []string {
     args := []string{"-i", iface}
     if host != "" { args = append(args, "--host", host) }
     if teaching && ip != "" { args = append(args, "--teaching-ip", ip) }
     if !teaching && ip != "" { args = append(args, "--dormitory-ip", ip) }
-    args = append(args, "--username", username, "--password", password)
-    cmd := exec.CommandContext(ctx, r.BinaryPath, args...)
-    cmd.Stdout = nil
-    cmd.Stderr = nil
-    return cmd.Run()
+    return args
 }
 
-func (r *Runner) LoginWithTimeout(iface, username, password, host string, teaching bool, ip string, timeout time.Duration) error {
-    ctx, cancel := context.WithTimeout(context.Background(), timeout)
-    defer cancel()
-    return r.Login(ctx, iface, username, password, host, teaching, ip)
+func (r *Runner) run(ctx context.Context, args []string) error {
+    if r.BinaryPath == "" { return fmt.Errorf("empty SZU-login binary path") }
+    return runCommand(ctx, exec.CommandContext(ctx, r.BinaryPath, args...))
 }
 
+// runCommand runs cmd, streams its output to the context's output func and classifies failures.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+    // stdout and stderr share one writer so lines keep their order
+    out := &lineWriter{emit: outputFunc(ctx)}
+    cmd.Stdout = out
+    cmd.Stderr = out
+    // once ctx is done, stop waiting for children (e.g. of a script) that still hold the pipes
+    cmd.WaitDelay = 2 * time.Second
+    err := cmd.Run()
+    out.Flush()
+    if err == nil { return nil }
+    if ctx.Err() != nil { err = ctx.Err() }
+    return Classify(out.String(), err)
+}
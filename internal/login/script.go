@@ -0,0 +1,36 @@
+package login
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+)
+
+// Script is the "script" authenticator: it runs a user-provided program with "login" or
+// "logout" as its only argument. Details are passed in the environment rather than on the
+// command line so the password does not show up in the process list:
+// NM_ACTION, NM_IFACE, NM_USERNAME, NM_PASSWORD (login only), NM_HOST, NM_IP, NM_TEACHING.
+// Its output is streamed and classified like srun-login's.
+type Script struct {
+    Path string
+}
+
+func (s *Script) Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error {
+    return s.run(ctx, "login", iface, username, password, host, teaching, ip)
+}
+
+func (s *Script) Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error {
+    return s.run(ctx, "logout", iface, username, "", host, teaching, ip)
+}
+
+func (s *Script) run(ctx context.Context, action, iface, username, password, host string, teaching bool, ip string) error {
+    if s.Path == "" { return fmt.Errorf("empty login script path") }
+    cmd := exec.CommandContext(ctx, s.Path, action)
+    area := "0"
+    if teaching { area = "1" }
+    cmd.Env = append(os.Environ(),
+        "NM_ACTION="+action, "NM_IFACE="+iface, "NM_USERNAME="+username, "NM_PASSWORD="+password,
+        "NM_HOST="+host, "NM_IP="+ip, "NM_TEACHING="+area)
+    return runCommand(ctx, cmd)
+}
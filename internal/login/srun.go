@@ -0,0 +1,212 @@
+package login
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/md5"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/netbind"
+)
+
+// DefaultSrunHost is the SRUN portal of the SZU teaching area.
+const DefaultSrunHost = "https://net.szu.edu.cn"
+
+// srunAlphabet is the shuffled base64 alphabet used by the SRUN portal scripts.
+const srunAlphabet = "LVoJPiCN2R8G90yg+hmFHuacZ1OWMnrsSTXkYpUq/3dlbfKwv6xztjI7DeBE45QA"
+
+var srunBase64 = base64.NewEncoding(srunAlphabet)
+
+// Srun is a pure-Go client for the SRUN portal login (challenge, xencode, hmac-md5, sha1).
+// It is a drop-in alternative to Runner: requests leave through the given NIC (SO_BINDTODEVICE
+// on Linux) and, when an IP is passed, from that source address.
+type Srun struct {
+    Host string // portal base URL; DefaultSrunHost when empty
+    ACID string // ac_id; discovered from the portal redirect when empty
+    // Client, when set, returns the HTTP client for requests leaving through iface, e.g. one that
+    // runs them on the router.
+    Client func(iface string) *http.Client
+}
+
+type srunChallenge struct {
+    Challenge string `json:"challenge"`
+    ClientIP  string `json:"client_ip"`
+    Error     string `json:"error"`
+}
+
+type srunResult struct {
+    Error    string `json:"error"`
+    ErrorMsg string `json:"error_msg"`
+    Ecode    any    `json:"ecode"`
+    Res      string `json:"res"`
+    SucMsg   string `json:"suc_msg"`
+}
+
+func (s *Srun) Login(ctx context.Context, iface, username, password string, host string, teaching bool, ip string) error {
+    if !teaching { return fmt.Errorf("srun: only the teaching area portal is supported") }
+    base := s.base(host)
+    client := s.httpClient(iface)
+    emit := outputFunc(ctx)
+
+    acid := s.ACID
+    if acid == "" { acid = discoverACID(ctx, client, base) }
+
+    emit(fmt.Sprintf("srun: requesting challenge from %s (ac_id=%s)", base, acid))
+    var ch srunChallenge
+    q := url.Values{"username": {username}, "ip": {ip}}
+    if err := srunGet(ctx, client, base+"/cgi-bin/get_challenge", q, &ch); err != nil { return Classify("", fmt.Errorf("srun challenge: %w", err)) }
+    if ch.Challenge == "" { return Classify(ch.Error, fmt.Errorf("srun challenge: empty token (%s)", ch.Error)) }
+    if ip == "" { ip = ch.ClientIP }
+    emit(fmt.Sprintf("srun: got challenge, client ip %s", ip))
+
+    token := ch.Challenge
+    info, _ := json.Marshal(map[string]string{"username": username, "password": password, "ip": ip, "acid": acid, "enc_ver": "srun_bx1"})
+    infoStr := "{SRBX1}" + srunBase64.EncodeToString(xencode(info, []byte(token)))
+    mac := hmac.New(md5.New, []byte(token))
+    mac.Write([]byte(password))
+    hmd5 := hex.EncodeToString(mac.Sum(nil))
+    const n, typ = "200", "1"
+    chk := token + username + token + hmd5 + token + acid + token + ip + token + n + token + typ + token + infoStr
+    sum := sha1.Sum([]byte(chk))
+
+    q = url.Values{
+        "action": {"login"}, "username": {username}, "password": {"{MD5}" + hmd5}, "ac_id": {acid}, "ip": {ip},
+        "chksum": {hex.EncodeToString(sum[:])}, "info": {infoStr}, "n": {n}, "type": {typ},
+        "os": {"Linux"}, "name": {"Linux"}, "double_stack": {"0"},
+    }
+    var res srunResult
+    if err := srunGet(ctx, client, base+"/cgi-bin/srun_portal", q, &res); err != nil { return Classify("", fmt.Errorf("srun login: %w", err)) }
+    if res.Error != "ok" {
+        msg := res.ErrorMsg
+        if msg == "" { msg = res.Res }
+        emit("srun: " + res.Error + ": " + msg)
+        return Rejected(res.Error+": "+msg, fmt.Errorf("srun login: %s", res.Error))
+    }
+    emit("srun: login ok (" + res.SucMsg + ")")
+    return nil
+}
+
+// Logout logs username off the portal. Without an ip the portal uses the address the request
+// comes from, i.e. the address of iface.
+func (s *Srun) Logout(ctx context.Context, iface, username string, host string, teaching bool, ip string) error {
+    if !teaching { return fmt.Errorf("srun: only the teaching area portal is supported") }
+    base := s.base(host)
+    client := s.httpClient(iface)
+    emit := outputFunc(ctx)
+    acid := s.ACID
+    if acid == "" { acid = discoverACID(ctx, client, base) }
+    emit(fmt.Sprintf("srun: logging %s off %s", username, base))
+    var res srunResult
+    q := url.Values{"action": {"logout"}, "username": {username}, "ip": {ip}, "ac_id": {acid}}
+    if err := srunGet(ctx, client, base+"/cgi-bin/srun_portal", q, &res); err != nil { return Classify("", fmt.Errorf("srun logout: %w", err)) }
+    if res.Error != "ok" && res.Error != "logout_ok" {
+        msg := res.ErrorMsg
+        if msg == "" { msg = res.Res }
+        emit("srun: " + res.Error + ": " + msg)
+        return Classify(res.Error+": "+msg, fmt.Errorf("srun logout: %s", res.Error))
+    }
+    emit("srun: logout ok")
+    return nil
+}
+
+func (s *Srun) base(host string) string {
+    base := host
+    if base == "" { base = s.Host }
+    if base == "" { base = DefaultSrunHost }
+    if !strings.Contains(base, "://") { base = "http://" + base }
+    return strings.TrimRight(base, "/")
+}
+
+// httpClient returns a client whose connections are bound to iface. The login ip is only sent
+// to the portal, never bound: it is usually read from the router and need not exist locally.
+func (s *Srun) httpClient(iface string) *http.Client {
+    if s.Client != nil { return s.Client(iface) }
+    d := &net.Dialer{Timeout: 10 * time.Second, Control: netbind.Control(iface)}
+    tr := &http.Transport{DialContext: d.DialContext, Proxy: nil, DisableKeepAlives: true}
+    return &http.Client{Transport: tr}
+}
+
+// discoverACID follows the portal's redirect to its login page and reads ac_id from the URL.
+func discoverACID(ctx context.Context, client *http.Client, base string) string {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/", nil)
+    if err != nil { return "1" }
+    resp, err := client.Do(req)
+    if err != nil { return "1" }
+    resp.Body.Close()
+    if v := resp.Request.URL.Query().Get("ac_id"); v != "" { return v }
+    return "1"
+}
+
+// srunGet performs a JSONP request and decodes the wrapped JSON object into v.
+func srunGet(ctx context.Context, client *http.Client, endpoint string, q url.Values, v any) error {
+    q.Set("callback", "jsonp")
+    q.Set("_", strconv.FormatInt(time.Now().UnixMilli(), 10))
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+    if err != nil { return err }
+    resp, err := client.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+    if err != nil { return err }
+    if resp.StatusCode != http.StatusOK { return fmt.Errorf("http %d", resp.StatusCode) }
+    return unwrapJSONP(string(body), v)
+}
+
+// unwrapJSONP decodes the JSON object inside a callback(...) answer into v.
+func unwrapJSONP(body string, v any) error {
+    s := strings.TrimSpace(body)
+    if i, j := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')'); i >= 0 && j > i { s = s[i+1 : j] }
+    return json.Unmarshal([]byte(s), v)
+}
+
+// xencode is the XXTEA variant used by the SRUN portal to encrypt the login info.
+func xencode(msg, key []byte) []byte {
+    if len(msg) == 0 { return nil }
+    v := srunWords(msg, true)
+    k := srunWords(key, false)
+    for len(k) < 4 { k = append(k, 0) }
+    n := uint32(len(v) - 1)
+    z, y := v[n], v[0]
+    const delta = 0x9E3779B9
+    var d uint32
+    for q := 6 + 52/(n+1); q > 0; q-- {
+        d += delta
+        e := d >> 2 & 3
+        var p uint32
+        for p = 0; p < n; p++ {
+            y = v[p+1]
+            m := (z>>5 ^ y<<2) + ((y>>3 ^ z<<4) ^ (d ^ y)) + (k[p&3^e] ^ z)
+            v[p] += m
+            z = v[p]
+        }
+        y = v[0]
+        m := (z>>5 ^ y<<2) + ((y>>3 ^ z<<4) ^ (d ^ y)) + (k[p&3^e] ^ z)
+        v[n] += m
+        z = v[n]
+    }
+    out := make([]byte, 4*len(v))
+    for i, w := range v { binary.LittleEndian.PutUint32(out[4*i:], w) }
+    return out
+}
+
+// srunWords packs b into little-endian words, optionally appending its length.
+func srunWords(b []byte, withLen bool) []uint32 {
+    padded := make([]byte, (len(b)+3)/4*4)
+    copy(padded, b)
+    out := make([]uint32, 0, len(padded)/4+1)
+    for i := 0; i < len(padded); i += 4 { out = append(out, binary.LittleEndian.Uint32(padded[i:])) }
+    if withLen { out = append(out, uint32(len(b))) }
+    return out
+}
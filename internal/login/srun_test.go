@@ -0,0 +1,171 @@
+package login
+
+import (
+    "context"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// Vectors computed with an independent port of the portal's JavaScript (xEncode, hmac-md5,
+// sha1 over the token-joined fields).
+const (
+    vecToken  = "0123456789abcdef0123456789abcdef"
+    vecUser   = "2020123456"
+    vecPass   = "p@ss word"
+    vecIP     = "172.30.1.2"
+    vecACID   = "12"
+    vecInfo   = "{SRBX1}sn5huzRwuVkwFtdQzqLdWmbFt0Ol491fk8xGDoFfEe2e0Lb6Ug3c54w8YBElN/afGYtpbQR0npyxm6YgNY4sWhXF9p83jUmJUCSCNN0BRcxvw2XoYVu7yB3L/UwfY6uNtuPhxdTQd0P="
+    vecHMD5   = "efeaeeb39b5de9ab9ca367c084334c27"
+    vecChksum = "830293191544421075df679abe2a8f1052214ced"
+)
+
+func TestXencode(t *testing.T) {
+    got := hex.EncodeToString(xencode([]byte("hello srun"), []byte("token")))
+    if want := "f882823f22dbcaad452d374f6fe66f9c"; got != want { t.Fatalf("xencode = %s, want %s", got, want) }
+    if xencode(nil, []byte("token")) != nil { t.Fatal("xencode of empty message should be empty") }
+}
+
+// fakePortal serves the SRUN JSONP endpoints and records the login request.
+type fakePortal struct {
+    mu     sync.Mutex
+    login  url.Values
+    result map[string]any // srun_portal answer
+    info   map[string]any // rad_user_info answer
+}
+
+func (f *fakePortal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    var v any
+    switch r.URL.Path {
+    case "/cgi-bin/get_challenge":
+        v = map[string]any{"challenge": vecToken, "client_ip": vecIP, "error": "ok"}
+    case "/cgi-bin/srun_portal":
+        f.mu.Lock()
+        f.login = q
+        v = f.result
+        f.mu.Unlock()
+    case "/cgi-bin/rad_user_info":
+        v = f.info
+    default:
+        http.NotFound(w, r); return
+    }
+    b, _ := json.Marshal(v)
+    fmt.Fprintf(w, "%s(%s)", q.Get("callback"), b)
+}
+
+func newFakePortal(t *testing.T) (*fakePortal, *Srun) {
+    f := &fakePortal{result: map[string]any{"error": "ok", "suc_msg": "login_ok"}}
+    ts := httptest.NewServer(f)
+    t.Cleanup(ts.Close)
+    return f, &Srun{Host: ts.URL, ACID: vecACID}
+}
+
+func TestSrunLogin(t *testing.T) {
+    f, s := newFakePortal(t)
+    var lines []string
+    ctx := WithOutput(context.Background(), func(line string) { lines = append(lines, line) })
+    if err := s.Login(ctx, "", vecUser, vecPass, "", true, ""); err != nil { t.Fatalf("login: %v", err) }
+
+    q := f.login
+    checks := map[string]string{
+        "action": "login", "username": vecUser, "ac_id": vecACID, "ip": vecIP, "n": "200", "type": "1",
+        "password": "{MD5}" + vecHMD5, "info": vecInfo, "chksum": vecChksum,
+    }
+    for k, want := range checks {
+        if got := q.Get(k); got != want { t.Errorf("%s = %q, want %q", k, got, want) }
+    }
+    if len(lines) == 0 || !strings.Contains(lines[len(lines)-1], "login ok") { t.Errorf("output = %q", lines) }
+}
+
+func TestSrunLoginReportsIP(t *testing.T) {
+    // the login ip usually belongs to the router, so it must not be bound locally
+    f, s := newFakePortal(t)
+    if err := s.Login(context.Background(), "", vecUser, vecPass, "", true, vecIP); err != nil { t.Fatalf("login with a foreign ip: %v", err) }
+    if got := f.login.Get("ip"); got != vecIP { t.Errorf("ip = %q, want %q", got, vecIP) }
+    if got := f.login.Get("chksum"); got != vecChksum { t.Errorf("chksum = %q, want %q", got, vecChksum) }
+}
+
+func TestSrunLoginErrors(t *testing.T) {
+    cases := []struct {
+        err, msg string
+        kind     Kind
+    }{
+        {"login_error", "E2531: User not found.", KindWrongPassword},
+        {"login_error", "E2901: (Third party 1)bind_user2: ldap_bind error", KindWrongPassword},
+        {"login_error", "E2616: Arrearage users.", KindArrears},
+        {"login_error", "E2620: You are already online.(online_num)", KindDeviceLimit},
+        {"login_error", "something odd", KindRejected},
+    }
+    for _, c := range cases {
+        f, s := newFakePortal(t)
+        f.result = map[string]any{"error": c.err, "error_msg": c.msg}
+        err := s.Login(context.Background(), "", vecUser, vecPass, "", true, "")
+        if err == nil { t.Errorf("%s: login succeeded", c.msg); continue }
+        if k := KindOf(err); k != c.kind { t.Errorf("%s: kind = %s, want %s", c.msg, k, c.kind) }
+        if !AccountFault(err) { t.Errorf("%s: a refused login should count against the account", c.msg) }
+    }
+}
+
+func TestSrunUnreachable(t *testing.T) {
+    ts := httptest.NewServer(http.NotFoundHandler())
+    host := ts.URL
+    ts.Close()
+    s := &Srun{Host: host, ACID: vecACID}
+    err := s.Login(context.Background(), "", vecUser, vecPass, "", true, "")
+    if k := KindOf(err); k != KindUnreachable { t.Fatalf("kind = %s (%v), want %s", k, err, KindUnreachable) }
+    if AccountFault(err) { t.Fatal("an unreachable portal is not the account's fault") }
+}
+
+func TestSetupErrorsAreNotAccountFaults(t *testing.T) {
+    s := &Srun{Host: "http://127.0.0.1:1"}
+    if err := s.Login(context.Background(), "", vecUser, vecPass, "", false, ""); err == nil || AccountFault(err) {
+        t.Fatalf("unsupported portal = %v, should fail without blaming the account", err)
+    }
+    r := &Runner{BinaryPath: "/nonexistent/srun-login"}
+    if err := r.Login(context.Background(), "", vecUser, vecPass, "", true, ""); err == nil || AccountFault(err) {
+        t.Fatalf("missing login tool = %v, should fail without blaming the account", err)
+    }
+    if AccountFault(fmt.Errorf("plain error")) { t.Fatal("an unclassified error is not the account's fault") }
+}
+
+func TestSrunStatus(t *testing.T) {
+    f, s := newFakePortal(t)
+    f.info = map[string]any{
+        "error": "ok", "user_name": vecUser, "online_ip": vecIP, "add_time": 1700000000,
+        "sum_bytes": "123456", "bytes_in": 100, "bytes_out": "200",
+    }
+    st, err := s.Status(context.Background(), "", "")
+    if err != nil { t.Fatalf("status: %v", err) }
+    if !st.Online || st.Username != vecUser || st.IP != vecIP || st.UsedBytes != 123456 || st.BytesIn != 100 || st.BytesOut != 200 || st.LoginAt.Unix() != 1700000000 {
+        t.Errorf("online status = %+v", st)
+    }
+
+    f.info = map[string]any{"error": "not_online_error", "client_ip": vecIP}
+    st, err = s.Status(context.Background(), "", "")
+    if err != nil { t.Fatalf("status: %v", err) }
+    if st.Online || st.IP != vecIP { t.Errorf("offline status = %+v", st) }
+}
+
+func TestSrunStatusOnRouter(t *testing.T) {
+    var sent string
+    exec := func(cmd string) (string, error) {
+        sent = cmd
+        return `jsonp({"error":"ok","user_name":"` + vecUser + `","online_ip":"` + vecIP + `","sum_bytes":42})`, nil
+    }
+    s := &Srun{Host: "172.30.255.42"}
+    st, err := s.StatusOnRouter(exec, "wanb", "", 10*time.Second)
+    if err != nil { t.Fatalf("status: %v", err) }
+    if want := "mwan3 use 'wanb' curl -s -m 10 'http://172.30.255.42/cgi-bin/rad_user_info?callback=jsonp'"; sent != want { t.Errorf("command = %s, want %s", sent, want) }
+    if !st.Online || st.Username != vecUser || st.UsedBytes != 42 { t.Errorf("status = %+v", st) }
+
+    failing := func(string) (string, error) { return "", fmt.Errorf("exit status 28") }
+    if _, err := s.StatusOnRouter(failing, "wanb", "", time.Second); err == nil { t.Fatal("a failed curl should fail the query") }
+}
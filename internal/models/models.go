@@ -9,6 +9,15 @@ const (
     BW200 Bandwidth = 200
 )
 
+// Valid reports whether b is one of the bandwidth tiers offered by the campus network.
+func (b Bandwidth) Valid() bool {
+    switch b {
+    case BW20, BW50, BW100, BW200:
+        return true
+    }
+    return false
+}
+
 type AccountState string
 
 const (
@@ -20,13 +29,55 @@ const (
     StateDisabled   AccountState = "DISABLED"
 )
 
+// transitions lists the states each state may move to. Anything else is a bug or a stale
+// state left behind by a crash, and is rejected.
+var transitions = map[AccountState][]AccountState{
+    StateIdle:       {StateConnecting, StateDisabled},
+    StateConnecting: {StateOnline, StateRetrying, StateFailed, StateIdle, StateDisabled},
+    StateOnline:     {StateIdle, StateConnecting, StateRetrying, StateDisabled},
+    StateRetrying:   {StateConnecting, StateFailed, StateIdle, StateDisabled},
+    StateFailed:     {StateConnecting, StateIdle, StateDisabled},
+    StateDisabled:   {StateIdle},
+}
+
+// Valid reports whether s is a known state.
+func (s AccountState) Valid() bool { _, ok := transitions[s]; return ok }
+
+// CanTransition reports whether an account may move from s to next.
+func (s AccountState) CanTransition(next AccountState) bool {
+    for _, t := range transitions[s] {
+        if t == next { return true }
+    }
+    return false
+}
+
 type Account struct {
-    ID         int64
-    Username   string
-    Password   string
-    Bandwidth  Bandwidth
-    Status     AccountState
-    LastUsedAt int64 // unix seconds
-    Disabled   bool
+    ID            int64
+    Username      string
+    Password      string // sealed; decrypt through service.Accounts.Password
+    Bandwidth     Bandwidth
+    Status        AccountState
+    LastUsedAt    int64 // unix seconds
+    Disabled      bool
+    FailCount     int   // consecutive failed logins
+    CooldownUntil int64 // unix seconds; a FAILED account is eligible again afterwards
+    Tags          []string
 }
 
+// HasAnyTag reports whether the account carries at least one of tags.
+func (a *Account) HasAnyTag(tags []string) bool {
+    for _, t := range tags {
+        for _, x := range a.Tags {
+            if x == t { return true }
+        }
+    }
+    return false
+}
+
+// StateChange describes one account state transition.
+type StateChange struct {
+    AccountID int64
+    Username  string
+    From      AccountState
+    To        AccountState
+}
@@ -2,7 +2,11 @@ package monitor
 
 import (
     "context"
-    "net/http"
+    "errors"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
     "time"
 
     "github.com/Sleepstars/SZU-NetManager/internal/ws"
@@ -10,9 +14,20 @@ import (
 
 type Trigger func(ctx context.Context, wanIface string)
 
+// PortalCheck reports whether the portal still sees an account online on wanIface.
+type PortalCheck func(ctx context.Context, wanIface string) (bool, error)
+
 type Config struct {
     Interval time.Duration
     TestURLs []string
+    // hysteresis: consecutive failed rounds before a failover, successful rounds before an
+    // interface counts as healthy again
+    FailAfter    int
+    RecoverAfter int
+    // flap protection: minimum time between failovers of one interface, and at most
+    // MaxPerHour failovers per interface in any hour (0 = unlimited) before the breaker opens
+    MinFailover  time.Duration
+    MaxPerHour   int
 }
 
 type Provider interface { // minimal interface to fetch iface map
@@ -24,11 +39,50 @@ type Monitor struct {
     cfg      Config
     prov     Provider
     trigger  Trigger
-    client   *http.Client
+    // Probe is the default check, an HTTP probe of TestURLs unless replaced; ProbeFor, when set,
+    // returns an interface's own probe (nil to use the default).
+    Probe    Probe
+    ProbeFor func(ctx context.Context, wanIface string) (Probe, error)
+    // Portal, when set, tells a logged-out interface (re-login) from an upstream outage (wait).
+    Portal   PortalCheck
+    // Healthy, when set, is called after each passing probe, e.g. to renew the account lease.
+    Healthy  Trigger
+    mu       sync.Mutex
+    state    map[string]*ifaceState
+}
+
+// Interface states. A failed interface is either logged out of the portal (NeedsLogin, fixed by
+// a re-login) or cut off upstream (Outage, which a re-login cannot fix).
+const (
+    StateUp         = "up"
+    StateNeedsLogin = "needs_login"
+    StateOutage     = "outage"
+)
+
+// ifaceState is the failover bookkeeping of one interface.
+type ifaceState struct {
+    fails, oks   int
+    state        string // "" until the first verdict
+    lastFailover time.Time
+    failovers    []time.Time // within the last hour
+    tripped      bool        // circuit breaker open
+}
+
+// IfaceStatus is the monitor's view of one interface.
+type IfaceStatus struct {
+    WanIface     string
+    State        string
+    Failures     int // consecutive failed rounds
+    Successes    int // consecutive successful rounds
+    LastFailover time.Time
+    FailoversHr  int // failovers in the last hour
+    Tripped      bool
 }
 
 func New(h *ws.Hub, cfg Config, prov Provider, trigger Trigger) *Monitor {
-    return &Monitor{hub: h, cfg: cfg, prov: prov, trigger: trigger, client: &http.Client{Timeout: 5 * time.Second}}
+    if cfg.FailAfter < 1 { cfg.FailAfter = 1 }
+    if cfg.RecoverAfter < 1 { cfg.RecoverAfter = 1 }
+    return &Monitor{hub: h, cfg: cfg, prov: prov, trigger: trigger, Probe: Default(cfg.TestURLs, 5*time.Second, ProbeEnv{}), state: map[string]*ifaceState{}}
 }
 
 func (m *Monitor) Run(ctx context.Context) {
@@ -45,24 +99,175 @@ func (m *Monitor) Run(ctx context.Context) {
     }
 }
 
+// checkAndMaybeTrigger probes every mapped interface through its own link. Once an interface has
+// failed FailAfter rounds it is classified: probes sent to the login portal, or a portal that no
+// longer sees the account online, mean it needs a login, which is triggered subject to the flap
+// protection; anything else is an outage and is only reported.
 func (m *Monitor) checkAndMaybeTrigger(ctx context.Context) {
-    if m.cfg.Interval <= 0 || len(m.cfg.TestURLs) == 0 { return }
-    ok := false
-    for _, u := range m.cfg.TestURLs {
-        req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-        resp, err := m.client.Do(req)
-        if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 500 {
-            ok = true
-        }
-        if resp != nil { resp.Body.Close() }
-        if ok { break }
-    }
-    if ok { return }
-    m.hub.Broadcast("检测到网络不可用，触发故障转移")
+    if m.cfg.Interval <= 0 { return }
     ifaces, err := m.prov.All(ctx)
     if err != nil { m.hub.Broadcast("读取接口映射失败"); return }
-    for wanIface := range ifaces {
+    m.forget(ifaces)
+    for wanIface, nic := range ifaces {
+        p := m.Probe
+        if m.ProbeFor != nil {
+            own, err := m.ProbeFor(ctx, wanIface)
+            if err != nil { m.hub.Broadcast(fmt.Sprintf("读取 %s 接口探测配置失败，使用默认探测: %v", wanIface, err)) }
+            if own != nil { p = own }
+        }
+        if p == nil { continue }
+        err := p.Check(ctx, wanIface, nic)
+        if ctx.Err() != nil { return }
+        if err == nil {
+            m.recordOK(wanIface)
+            if m.Healthy != nil { m.Healthy(ctx, wanIface) }
+            continue
+        }
+        if !m.recordFail(wanIface, err) { continue }
+        needsLogin := errors.Is(err, ErrNeedsLogin)
+        reason := err.Error()
+        if !needsLogin && m.Portal != nil {
+            online, perr := m.Portal(ctx, wanIface)
+            switch {
+            case perr != nil:
+                reason = fmt.Sprintf("无法访问认证网关: %v", perr)
+            case online:
+                reason = "账号仍在线，上游网络故障"
+            default:
+                needsLogin = true
+            }
+        }
+        if !needsLogin { m.setState(wanIface, StateOutage, reason); continue }
+        m.setState(wanIface, StateNeedsLogin, reason)
+        if !m.allowFailover(wanIface) { continue }
+        m.hub.Broadcast(fmt.Sprintf("%s 接口需要重新认证，重新登录", wanIface))
+        m.recordFailover(wanIface)
         m.trigger(ctx, wanIface)
     }
 }
 
+// forget drops the state of interfaces that are no longer mapped.
+func (m *Monitor) forget(ifaces map[string]string) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    for wan := range m.state {
+        if _, ok := ifaces[wan]; !ok { delete(m.state, wan) }
+    }
+}
+
+// get returns the state of wanIface; callers hold m.mu.
+func (m *Monitor) get(wanIface string) *ifaceState {
+    st := m.state[wanIface]
+    if st == nil {
+        st = &ifaceState{}
+        m.state[wanIface] = st
+    }
+    return st
+}
+
+func (m *Monitor) recordOK(wanIface string) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    st.fails = 0
+    st.oks++
+    if st.state == "" { st.state = StateUp }
+    if st.state != StateUp && st.oks >= m.cfg.RecoverAfter {
+        st.state = StateUp
+        m.hub.Broadcast(fmt.Sprintf("%s 接口连续 %d 次探测正常，已恢复", wanIface, st.oks))
+    }
+}
+
+// recordFail records a failed round and reports whether wanIface has failed FailAfter rounds.
+func (m *Monitor) recordFail(wanIface string, probeErr error) bool {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    st.oks = 0
+    st.fails++
+    if st.fails < m.cfg.FailAfter {
+        m.hub.Broadcast(fmt.Sprintf("%s 接口探测失败（%d/%d）: %v", wanIface, st.fails, m.cfg.FailAfter, probeErr))
+        return false
+    }
+    return true
+}
+
+// setState records the verdict for a failed interface and announces changes. Outages raise an
+// alert, since re-logging in cannot fix them.
+func (m *Monitor) setState(wanIface, state, reason string) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    if st.state == state { return }
+    st.state = state
+    switch state {
+    case StateOutage:
+        m.hub.Broadcast(fmt.Sprintf("告警：%s 接口上游网络故障（%s），重新登录无法解决，不再自动登录", wanIface, reason))
+        log.Printf("monitor: %s outage: %s", wanIface, reason)
+    case StateNeedsLogin:
+        m.hub.Broadcast(fmt.Sprintf("检测到 %s 接口认证已失效（%s）", wanIface, reason))
+    }
+}
+
+// allowFailover applies the minimum interval and the hourly circuit breaker to a re-login.
+func (m *Monitor) allowFailover(wanIface string) bool {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    if since := time.Since(st.lastFailover); since < m.cfg.MinFailover {
+        m.hub.Broadcast(fmt.Sprintf("%s 接口距上次故障转移仅 %s，暂不重新登录", wanIface, since.Truncate(time.Second)))
+        return false
+    }
+    m.prune(wanIface, st)
+    if m.cfg.MaxPerHour > 0 && len(st.failovers) >= m.cfg.MaxPerHour {
+        if !st.tripped {
+            st.tripped = true
+            msg := fmt.Sprintf("告警：%s 接口一小时内已故障转移 %d 次，已熔断并停止自动重新登录，请人工检查", wanIface, len(st.failovers))
+            m.hub.Broadcast(msg)
+            log.Printf("monitor: %s circuit breaker open after %d failovers in the last hour", wanIface, len(st.failovers))
+        }
+        return false
+    }
+    return true
+}
+
+func (m *Monitor) recordFailover(wanIface string) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    st.fails = 0
+    st.lastFailover = time.Now()
+    st.failovers = append(st.failovers, st.lastFailover)
+}
+
+// prune drops failovers older than an hour and closes the breaker once below the limit;
+// callers hold m.mu.
+func (m *Monitor) prune(wanIface string, st *ifaceState) {
+    cutoff := time.Now().Add(-time.Hour)
+    n := 0
+    for _, t := range st.failovers {
+        if t.After(cutoff) { st.failovers[n] = t; n++ }
+    }
+    st.failovers = st.failovers[:n]
+    if st.tripped && (m.cfg.MaxPerHour <= 0 || n < m.cfg.MaxPerHour) {
+        st.tripped = false
+        m.hub.Broadcast(fmt.Sprintf("%s 接口的故障转移熔断已自动解除", wanIface))
+    }
+}
+
+// Status returns the failover state of the interfaces seen so far, sorted by name.
+func (m *Monitor) Status() []IfaceStatus {
+    m.mu.Lock(); defer m.mu.Unlock()
+    out := make([]IfaceStatus, 0, len(m.state))
+    for wan, st := range m.state {
+        m.prune(wan, st)
+        out = append(out, IfaceStatus{
+            WanIface: wan, State: st.state, Failures: st.fails, Successes: st.oks,
+            LastFailover: st.lastFailover, FailoversHr: len(st.failovers), Tripped: st.tripped,
+        })
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].WanIface < out[j].WanIface })
+    return out
+}
+
+// Reset closes the circuit breaker of wanIface and forgets its failover history.
+func (m *Monitor) Reset(wanIface string) {
+    m.mu.Lock(); defer m.mu.Unlock()
+    st := m.get(wanIface)
+    st.failovers, st.tripped, st.lastFailover = nil, false, time.Time{}
+    m.hub.Broadcast(fmt.Sprintf("%s 接口的故障转移熔断已手动重置", wanIface))
+}
@@ -0,0 +1,60 @@
+package monitor
+
+import (
+    "bytes"
+    "errors"
+    "net"
+    "net/url"
+    "strings"
+)
+
+// ErrNeedsLogin is wrapped by probes whose request ended up at the login portal.
+var ErrNeedsLogin = errors.New("redirected to the login portal")
+
+// DefaultFingerprints are strings found in SRUN portal pages and scripts.
+var DefaultFingerprints = []string{"srun_portal", "get_challenge", "srun_bx1"}
+
+// PortalDetector recognises answers that come from the captive portal instead of the probed
+// site: redirects to a known portal host, or pages that mention one or carry a fingerprint.
+type PortalDetector struct {
+    hosts        []string
+    fingerprints [][]byte
+}
+
+// NewPortalDetector accepts hosts as bare names, host:port or URLs. Without fingerprints it uses
+// DefaultFingerprints.
+func NewPortalDetector(hosts, fingerprints []string) *PortalDetector {
+    if len(fingerprints) == 0 { fingerprints = DefaultFingerprints }
+    d := &PortalDetector{}
+    for _, h := range hosts {
+        h = strings.TrimSpace(h)
+        if u, err := url.Parse(h); err == nil && u.Host != "" { h = u.Hostname() }
+        if host, _, err := net.SplitHostPort(h); err == nil { h = host }
+        if h != "" { d.hosts = append(d.hosts, strings.ToLower(h)) }
+    }
+    for _, f := range fingerprints {
+        if f = strings.TrimSpace(f); f != "" { d.fingerprints = append(d.fingerprints, bytes.ToLower([]byte(f))) }
+    }
+    return d
+}
+
+// Match reports whether a response that redirected to location (may be empty) or returned body
+// was served by the portal.
+func (d *PortalDetector) Match(location string, body []byte) bool {
+    if d == nil { return false }
+    if u, err := url.Parse(location); location != "" && err == nil {
+        host := strings.ToLower(u.Hostname())
+        for _, h := range d.hosts {
+            if host == h { return true }
+        }
+    }
+    lower := bytes.ToLower(body)
+    for _, h := range d.hosts {
+        // meta refresh or script redirects name the portal in the page
+        if bytes.Contains(lower, []byte(h)) { return true }
+    }
+    for _, f := range d.fingerprints {
+        if bytes.Contains(lower, f) { return true }
+    }
+    return false
+}
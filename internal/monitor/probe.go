@@ -0,0 +1,210 @@
+package monitor
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/netbind"
+    "github.com/Sleepstars/SZU-NetManager/internal/service"
+    "github.com/Sleepstars/SZU-NetManager/internal/sshqueue"
+)
+
+// Probe checks connectivity through one WAN; nic is the device mapped to it. A nil error means
+// the link works.
+type Probe interface {
+    Check(ctx context.Context, wanIface, nic string) error
+}
+
+// Exec runs a shell command on the router; sshqueue.Queue.Exec fits.
+type Exec func(cmd string) (string, error)
+
+// ProbeEnv is what probes are built with: the router connection (needed for ping, and for http
+// when RouterHTTP is set) and the portal detector for http probes. RouterHTTP means the NICs are
+// router devices, so tcp and dns probes, which run on the backend host, cannot be built.
+type ProbeEnv struct {
+    Exec       Exec
+    RouterHTTP bool
+    Portal     *PortalDetector
+}
+
+// HTTPProbe fetches URL and expects Status (any 2xx when 0) and, if set, Body in the response.
+// Redirects are not followed, so a captive portal's 302 counts as a failure; with Portal set, a
+// response that fails the expectation and came from the portal fails with ErrNeedsLogin. With Exec set the request runs on the router
+// under `mwan3 use <wan>`; otherwise it leaves the backend host bound to the NIC
+// (SO_BINDTODEVICE, Linux only).
+type HTTPProbe struct {
+    URL     string
+    Status  int
+    Body    string
+    Timeout time.Duration
+    Exec    Exec
+    Portal  *PortalDetector
+}
+
+func (p HTTPProbe) Check(ctx context.Context, wanIface, nic string) error {
+    var code int
+    var location string
+    var body []byte
+    if p.Exec != nil {
+        // the status code and redirect target go on a line of their own after the body
+        cmd := fmt.Sprintf("mwan3 use %s curl -s -m %d -w '\\n%%{http_code} %%{redirect_url}' %s", sshqueue.Quote(wanIface), seconds(p.Timeout), sshqueue.Quote(p.URL))
+        out, err := p.Exec(cmd)
+        if err != nil { return fmt.Errorf("%s: %v", p.URL, err) }
+        out = strings.TrimRight(out, "\n")
+        i := strings.LastIndexByte(out, '\n')
+        status, redirect, _ := strings.Cut(strings.TrimSpace(out[i+1:]), " ")
+        code, _ = strconv.Atoi(status)
+        location = strings.TrimSpace(redirect)
+        if i > 0 { body = []byte(out[:i]) }
+    } else {
+        d := &net.Dialer{Timeout: p.Timeout, Control: netbind.Control(nic)}
+        client := &http.Client{
+            Timeout:       p.Timeout,
+            Transport:     &http.Transport{DialContext: d.DialContext, Proxy: nil, DisableKeepAlives: true},
+            CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+        }
+        req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+        if err != nil { return err }
+        resp, err := client.Do(req)
+        if err != nil { return err }
+        defer resp.Body.Close()
+        code = resp.StatusCode
+        location = resp.Header.Get("Location")
+        if p.Body != "" || p.Portal != nil { body, _ = io.ReadAll(io.LimitReader(resp.Body, 64<<10)) }
+    }
+    err := p.expect(code, body)
+    if err == nil { return nil }
+    // a healthy page may well mention the portal; only a failed check is blamed on it
+    if p.Portal.Match(location, body) {
+        if location != "" { return fmt.Errorf("%s: %w (http %d to %s)", p.URL, ErrNeedsLogin, code, location) }
+        return fmt.Errorf("%s: %w (http %d)", p.URL, ErrNeedsLogin, code)
+    }
+    return err
+}
+
+func (p HTTPProbe) expect(code int, body []byte) error {
+    if p.Status != 0 && code != p.Status { return fmt.Errorf("%s: http %d, want %d", p.URL, code, p.Status) }
+    if p.Status == 0 && (code < 200 || code > 299) { return fmt.Errorf("%s: http %d", p.URL, code) }
+    if p.Body != "" && !bytes.Contains(body, []byte(p.Body)) { return fmt.Errorf("%s: response does not contain %q", p.URL, p.Body) }
+    return nil
+}
+
+// TCPProbe connects to Addr (host:port) from the backend host, bound to the NIC.
+type TCPProbe struct {
+    Addr    string
+    Timeout time.Duration
+}
+
+func (p TCPProbe) Check(ctx context.Context, wanIface, nic string) error {
+    d := &net.Dialer{Timeout: p.Timeout, Control: netbind.Control(nic)}
+    c, err := d.DialContext(ctx, "tcp", p.Addr)
+    if err != nil { return err }
+    return c.Close()
+}
+
+// DNSProbe resolves Name through Resolver (host[:port], the system resolver when empty), with
+// the queries bound to the NIC.
+type DNSProbe struct {
+    Name     string
+    Resolver string
+    Timeout  time.Duration
+}
+
+func (p DNSProbe) Check(ctx context.Context, wanIface, nic string) error {
+    server := p.Resolver
+    if server != "" {
+        if _, _, err := net.SplitHostPort(server); err != nil { server = net.JoinHostPort(server, "53") }
+    }
+    r := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+        d := &net.Dialer{Timeout: p.Timeout, Control: netbind.Control(nic)}
+        if server != "" { address = server }
+        return d.DialContext(ctx, network, address)
+    }}
+    ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+    defer cancel()
+    addrs, err := r.LookupHost(ctx, p.Name)
+    if err != nil { return err }
+    if len(addrs) == 0 { return fmt.Errorf("%s: no addresses", p.Name) }
+    return nil
+}
+
+// PingProbe pings Host once on the router under `mwan3 use <wan>`.
+type PingProbe struct {
+    Host    string
+    Timeout time.Duration
+    Exec    Exec
+}
+
+func (p PingProbe) Check(ctx context.Context, wanIface, nic string) error {
+    if p.Exec == nil { return errors.New("ping probe needs the router connection") }
+    cmd := fmt.Sprintf("mwan3 use %s ping -c 1 -W %d %s", sshqueue.Quote(wanIface), seconds(p.Timeout), sshqueue.Quote(p.Host))
+    if _, err := p.Exec(cmd); err != nil { return fmt.Errorf("ping %s: %v", p.Host, err) }
+    return nil
+}
+
+// AnyOf passes when one of its probes passes. Otherwise it returns a portal redirect if one
+// probe saw it, else the last failure.
+type AnyOf []Probe
+
+func (a AnyOf) Check(ctx context.Context, wanIface, nic string) error {
+    last := errors.New("no probes")
+    var portal error
+    for _, p := range a {
+        if ctx.Err() != nil { return ctx.Err() }
+        err := p.Check(ctx, wanIface, nic)
+        if err == nil { return nil }
+        if errors.Is(err, ErrNeedsLogin) && portal == nil { portal = err }
+        last = err
+    }
+    if portal != nil { return portal }
+    return last
+}
+
+// Default builds the probe used for interfaces without their own: an HTTP check of each URL.
+func Default(urls []string, timeout time.Duration, env ProbeEnv) Probe {
+    var out AnyOf
+    for _, u := range urls { out = append(out, env.http(HTTPProbe{URL: u, Timeout: timeout})) }
+    if len(out) == 0 { return nil }
+    return out
+}
+
+// Build turns configured specs into a probe. tcp and dns probes always run on the backend host
+// and are refused in router mode.
+func Build(specs []service.ProbeSpec, env ProbeEnv) (Probe, error) {
+    var out AnyOf
+    for _, s := range specs {
+        if err := s.Validate(); err != nil { return nil, err }
+        if env.RouterHTTP && s.Local() { return nil, service.LocalProbeError(s.Type) }
+        switch s.Type {
+        case service.ProbeHTTP:
+            out = append(out, env.http(HTTPProbe{URL: s.Target, Status: s.Status, Body: s.Body, Timeout: s.Timeout()}))
+        case service.ProbeTCP:
+            out = append(out, TCPProbe{Addr: s.Target, Timeout: s.Timeout()})
+        case service.ProbeDNS:
+            out = append(out, DNSProbe{Name: s.Target, Resolver: s.Resolver, Timeout: s.Timeout()})
+        case service.ProbePing:
+            out = append(out, PingProbe{Host: s.Target, Timeout: s.Timeout(), Exec: env.Exec})
+        }
+    }
+    if len(out) == 0 { return nil, nil }
+    return out, nil
+}
+
+func (env ProbeEnv) http(p HTTPProbe) HTTPProbe {
+    if env.RouterHTTP { p.Exec = env.Exec }
+    p.Portal = env.Portal
+    return p
+}
+
+func seconds(d time.Duration) int {
+    if s := int(d.Seconds()); s > 0 { return s }
+    return 1
+}
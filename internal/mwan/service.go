@@ -30,10 +30,18 @@ func (s *Service) ApplyWeight(wanIface string, weight int) error {
     if err := s.u.Restart(); err != nil { _ = s.u.Rollback(backupPath); return fmt.Errorf("restart: %w", err) }
 
     time.Sleep(2 * time.Second)
-    status, err := s.u.Status()
+    status, _, err := s.Status()
     if err != nil { _ = s.u.Rollback(backupPath); return fmt.Errorf("status: %w", err) }
-    // Minimal verification: expect the interface string to appear; allow success if not conclusive.
-    if status == "" { _ = s.u.Rollback(backupPath); return fmt.Errorf("empty status after restart") }
+    // mwan3 must be tracking the interface again; whether it is online depends on the link
+    if len(status.Interfaces) == 0 { _ = s.u.Rollback(backupPath); return fmt.Errorf("mwan3 status lists no interfaces after restart") }
+    if _, ok := status.Interface(wanIface); !ok { _ = s.u.Rollback(backupPath); return fmt.Errorf("interface %s missing from mwan3 status after restart", wanIface) }
     return nil
 }
 
+// Status runs `mwan3 status` and returns it parsed along with the raw text.
+func (s *Service) Status() (*Status, string, error) {
+    raw, err := s.u.Status()
+    if err != nil { return nil, "", err }
+    return ParseStatus(raw), raw, nil
+}
+
@@ -0,0 +1,130 @@
+package mwan
+
+import (
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Status is the parsed output of `mwan3 status`.
+type Status struct {
+    Interfaces []InterfaceStatus
+    Policies   []Policy
+}
+
+// InterfaceStatus is one line of the "Interface status" section, e.g.
+//
+//  interface wan is online 01h:23m:45s, uptime 02h:00m:01s and tracking is active
+//  interface wanb is offline and tracking is active
+type InterfaceStatus struct {
+    Name     string
+    State    string        // online, offline, disabled, connecting, disconnecting, error, ...
+    Online   time.Duration // time since the interface went online; 0 if unknown or offline
+    Uptime   time.Duration // uptime of the underlying network interface; 0 if not reported
+    Tracking string        // active, paused, down, disabled, not enabled
+}
+
+func (i InterfaceStatus) IsOnline() bool { return i.State == "online" }
+
+// Policy is one policy of the "Current ipv4/ipv6 policies" sections. A policy without usable
+// members has Fallback set to what mwan3 does instead (unreachable, blackhole or default).
+type Policy struct {
+    Family   string // ipv4 or ipv6
+    Name     string
+    Members  []PolicyMember
+    Fallback string
+}
+
+type PolicyMember struct {
+    Interface string
+    Percent   int
+}
+
+// Interface returns the status of the named interface.
+func (s *Status) Interface(name string) (InterfaceStatus, bool) {
+    for _, i := range s.Interfaces {
+        if i.Name == name { return i, true }
+    }
+    return InterfaceStatus{}, false
+}
+
+var (
+    mwanDuration = regexp.MustCompile(`(\d+)h:(\d+)m:(\d+)s`)
+    policyMember = regexp.MustCompile(`^(\S+) \((\d+)%\)$`)
+    policyHeader = regexp.MustCompile(`^Current (ipv[46]) policies:$`)
+)
+
+// ParseStatus parses `mwan3 status` as printed by mwan3 2.8 and later. Sections it does not
+// know (connected networks, user rules) are skipped.
+func ParseStatus(raw string) *Status {
+    st := &Status{}
+    section, family := "", ""
+    var policy *Policy
+    flush := func() {
+        if policy != nil { st.Policies = append(st.Policies, *policy) }
+        policy = nil
+    }
+    for _, line := range strings.Split(raw, "\n") {
+        text := strings.TrimSpace(line)
+        if text == "" { continue }
+        indented := line != strings.TrimLeft(line, " \t")
+        if !indented {
+            if strings.HasSuffix(text, ":") && section == "policies" && !strings.HasPrefix(text, "Current ") && !strings.Contains(text, " ") {
+                flush()
+                policy = &Policy{Family: family, Name: strings.TrimSuffix(text, ":")}
+                continue
+            }
+            flush()
+            switch m := policyHeader.FindStringSubmatch(text); {
+            case text == "Interface status:":
+                section = "interfaces"
+            case m != nil:
+                section, family = "policies", m[1]
+            default:
+                section = ""
+            }
+            continue
+        }
+        switch section {
+        case "interfaces":
+            if i, ok := parseInterfaceLine(text); ok { st.Interfaces = append(st.Interfaces, i) }
+        case "policies":
+            if policy == nil { continue }
+            if m := policyMember.FindStringSubmatch(text); m != nil {
+                pct, _ := strconv.Atoi(m[2])
+                policy.Members = append(policy.Members, PolicyMember{Interface: m[1], Percent: pct})
+            } else {
+                policy.Fallback = text
+            }
+        }
+    }
+    flush()
+    return st
+}
+
+// parseInterfaceLine parses "interface <name> is <state> [online time][, uptime <time>] and tracking is <tracking>".
+func parseInterfaceLine(text string) (InterfaceStatus, bool) {
+    rest, ok := strings.CutPrefix(text, "interface ")
+    if !ok { return InterfaceStatus{}, false }
+    name, rest, ok := strings.Cut(rest, " is ")
+    if !ok { return InterfaceStatus{}, false }
+    i := InterfaceStatus{Name: name}
+    rest, i.Tracking, _ = strings.Cut(rest, " and tracking is ")
+    state, times, _ := strings.Cut(rest, " ")
+    i.State = state
+    online, uptime, _ := strings.Cut(times, "uptime")
+    if i.IsOnline() { i.Online = parseMwanDuration(online) }
+    i.Uptime = parseMwanDuration(uptime)
+    return i, true
+}
+
+// parseMwanDuration reads mwan3's "HHh:MMm:SSs" format.
+func parseMwanDuration(s string) time.Duration {
+    m := mwanDuration.FindStringSubmatch(s)
+    if m == nil { return 0 }
+    h, _ := strconv.Atoi(m[1])
+    min, _ := strconv.Atoi(m[2])
+    sec, _ := strconv.Atoi(m[3])
+    return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+}
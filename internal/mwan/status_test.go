@@ -0,0 +1,94 @@
+package mwan
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func hms(h, m, s int) time.Duration {
+    return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
+
+func TestParseStatus(t *testing.T) {
+    cases := []struct {
+        file string
+        want Status
+    }{
+        {"all_online.txt", Status{
+            Interfaces: []InterfaceStatus{
+                {Name: "wan", State: "online", Online: hms(1, 23, 45), Uptime: hms(2, 0, 1), Tracking: "active"},
+                {Name: "wanb", State: "online", Online: hms(0, 5, 10), Uptime: hms(0, 6, 0), Tracking: "active"},
+                {Name: "wanc", State: "online", Online: hms(12, 0, 0), Uptime: hms(12, 0, 3), Tracking: "active"},
+            },
+            Policies: []Policy{
+                {Family: "ipv4", Name: "balanced", Members: []PolicyMember{{"wanc", 34}, {"wanb", 33}, {"wan", 33}}},
+                {Family: "ipv4", Name: "wan_only", Members: []PolicyMember{{"wan", 100}}},
+                {Family: "ipv6", Name: "balanced", Fallback: "unreachable"},
+            },
+        }},
+        {"one_offline.txt", Status{
+            Interfaces: []InterfaceStatus{
+                {Name: "wan", State: "online", Online: hms(0, 41, 7), Uptime: hms(0, 41, 12), Tracking: "active"},
+                {Name: "wanb", State: "offline", Tracking: "down"},
+                {Name: "wanc", State: "disabled", Tracking: "not enabled"},
+            },
+            Policies: []Policy{
+                {Family: "ipv4", Name: "balanced", Members: []PolicyMember{{"wan", 100}}},
+                {Family: "ipv4", Name: "wanb_only", Fallback: "unreachable"},
+                {Family: "ipv4", Name: "wanc_only", Fallback: "blackhole"},
+                {Family: "ipv6", Name: "balanced", Fallback: "unreachable"},
+            },
+        }},
+    }
+    for _, c := range cases {
+        raw, err := os.ReadFile(filepath.Join("testdata", c.file))
+        if err != nil { t.Fatal(err) }
+        got := ParseStatus(string(raw))
+        if !reflect.DeepEqual(got.Interfaces, c.want.Interfaces) { t.Errorf("%s: interfaces\n got %+v\nwant %+v", c.file, got.Interfaces, c.want.Interfaces) }
+        if !reflect.DeepEqual(got.Policies, c.want.Policies) { t.Errorf("%s: policies\n got %+v\nwant %+v", c.file, got.Policies, c.want.Policies) }
+    }
+}
+
+// TestParseStatusSynthetic feeds hand-written input, not captured mwan3 output: leading and
+// doubled blank lines, an interface without uptime and an unknown section between the policy
+// sections, which the parser must skip.
+func TestParseStatusSynthetic(t *testing.T) {
+    raw := "\nInterface status:\n" +
+        " interface wan is online 00h:00m:59s, uptime 00h:01m:00s and tracking is active\n" +
+        " interface wanb is online 03h:10m:00s and tracking is paused\n\n\n" +
+        "Current ipv4 policies:\nweighted:\n wan (75%)\n wanb (25%)\n\n" +
+        "Unknown section:\n not a policy\n\n" +
+        "Current ipv6 policies:\nweighted:\n default\n"
+    want := Status{
+        Interfaces: []InterfaceStatus{
+            {Name: "wan", State: "online", Online: hms(0, 0, 59), Uptime: hms(0, 1, 0), Tracking: "active"},
+            {Name: "wanb", State: "online", Online: hms(3, 10, 0), Tracking: "paused"},
+        },
+        Policies: []Policy{
+            {Family: "ipv4", Name: "weighted", Members: []PolicyMember{{"wan", 75}, {"wanb", 25}}},
+            {Family: "ipv6", Name: "weighted", Fallback: "default"},
+        },
+    }
+    got := ParseStatus(raw)
+    if !reflect.DeepEqual(got.Interfaces, want.Interfaces) { t.Errorf("interfaces\n got %+v\nwant %+v", got.Interfaces, want.Interfaces) }
+    if !reflect.DeepEqual(got.Policies, want.Policies) { t.Errorf("policies\n got %+v\nwant %+v", got.Policies, want.Policies) }
+}
+
+func TestParseStatusEmpty(t *testing.T) {
+    for _, raw := range []string{"", "\n\n", "Interface status:\n\nCurrent ipv4 policies:\n", "mwan3 is not running\n"} {
+        st := ParseStatus(raw)
+        if len(st.Interfaces) != 0 || len(st.Policies) != 0 { t.Errorf("%q: got %+v", raw, st) }
+    }
+}
+
+func TestStatusInterface(t *testing.T) {
+    raw, err := os.ReadFile(filepath.Join("testdata", "one_offline.txt"))
+    if err != nil { t.Fatal(err) }
+    st := ParseStatus(string(raw))
+    if i, ok := st.Interface("wan"); !ok || !i.IsOnline() { t.Errorf("wan = %+v, %v", i, ok) }
+    if i, ok := st.Interface("wanb"); !ok || i.IsOnline() || i.Online != 0 { t.Errorf("wanb = %+v, %v", i, ok) }
+    if _, ok := st.Interface("wan6"); ok { t.Error("wan6 should not be listed") }
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+// Package netbind pins sockets to a network device, so traffic leaves through a chosen NIC
+// rather than the default route.
+package netbind
+
+import "syscall"
+
+// Control pins outgoing sockets to iface with SO_BINDTODEVICE (needs CAP_NET_RAW).
+func Control(iface string) func(network, address string, c syscall.RawConn) error {
+    if iface == "" { return nil }
+    return func(network, address string, c syscall.RawConn) error {
+        var serr error
+        err := c.Control(func(fd uintptr) { serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface) })
+        if err != nil { return err }
+        return serr
+    }
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package netbind
+
+import "syscall"
+
+// Control is a no-op outside Linux; there traffic follows the routing table.
+func Control(iface string) func(network, address string, c syscall.RawConn) error { return nil }
@@ -0,0 +1,87 @@
+package secret
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// prefix marks values sealed by Box so that plaintext rows can be told apart during migration.
+const prefix = "enc:v1:"
+
+var ErrNotSealed = errors.New("value is not sealed")
+
+// Box seals short secrets (account passwords) with AES-256-GCM under a master key.
+type Box struct { aead cipher.AEAD }
+
+// New derives an AES-256 key from arbitrary key material (hex key, passphrase, ...).
+func New(key []byte) (*Box, error) {
+    if len(key) == 0 { return nil, fmt.Errorf("empty master key") }
+    sum := sha256.Sum256(key)
+    block, err := aes.NewCipher(sum[:])
+    if err != nil { return nil, err }
+    aead, err := cipher.NewGCM(block)
+    if err != nil { return nil, err }
+    return &Box{aead: aead}, nil
+}
+
+// IsSealed reports whether s was produced by Seal.
+func IsSealed(s string) bool { return strings.HasPrefix(s, prefix) }
+
+func (b *Box) Seal(plain string) (string, error) {
+    nonce := make([]byte, b.aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil { return "", err }
+    ct := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+    return prefix + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+func (b *Box) Open(sealed string) (string, error) {
+    if !IsSealed(sealed) { return "", ErrNotSealed }
+    raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, prefix))
+    if err != nil { return "", fmt.Errorf("decode sealed value: %w", err) }
+    n := b.aead.NonceSize()
+    if len(raw) < n { return "", fmt.Errorf("sealed value too short") }
+    plain, err := b.aead.Open(nil, raw[:n], raw[n:], nil)
+    if err != nil { return "", fmt.Errorf("decrypt: wrong master key or corrupted value") }
+    return string(plain), nil
+}
+
+// GenerateKey returns a fresh random key encoded as hex.
+func GenerateKey() ([]byte, error) {
+    k := make([]byte, 32)
+    if _, err := rand.Read(k); err != nil { return nil, err }
+    return []byte(hex.EncodeToString(k)), nil
+}
+
+// LoadKey returns the master key from envValue if set, otherwise from path.
+// A missing key file is created with a random key; created reports whether that happened.
+func LoadKey(envValue, path string) (key []byte, created bool, err error) {
+    if envValue != "" { return []byte(envValue), false, nil }
+    if path == "" { return nil, false, fmt.Errorf("no master key configured") }
+    data, err := os.ReadFile(path)
+    if err == nil {
+        key = []byte(strings.TrimSpace(string(data)))
+        if len(key) == 0 { return nil, false, fmt.Errorf("master key file %s is empty", path) }
+        return key, false, nil
+    }
+    if !errors.Is(err, os.ErrNotExist) { return nil, false, fmt.Errorf("read master key: %w", err) }
+    key, err = GenerateKey()
+    if err != nil { return nil, false, err }
+    if err := WriteKey(path, key); err != nil { return nil, false, err }
+    return key, true, nil
+}
+
+// WriteKey stores key at path with owner-only permissions, refusing to overwrite.
+func WriteKey(path string, key []byte) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+    if err != nil { return fmt.Errorf("write master key: %w", err) }
+    if _, err := f.Write(append(key, '\n')); err != nil { f.Close(); return fmt.Errorf("write master key: %w", err) }
+    return f.Close()
+}
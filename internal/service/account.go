@@ -4,73 +4,339 @@ import (
     "context"
     "database/sql"
     "errors"
+    "fmt"
+    "strings"
+    "sync"
     "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+    "github.com/Sleepstars/SZU-NetManager/internal/secret"
+    "github.com/ncruces/go-sqlite3"
+)
+
+var (
+    ErrNotFound       = errors.New("account not found")
+    ErrInvalidAccount = errors.New("invalid account")
+    ErrAccountOnline  = errors.New("account is online")
+    ErrDuplicate      = errors.New("username already exists")
 )
 
-type Account struct {
-    ID         int64
-    Username   string
-    Password   string
-    Bandwidth  int
-    Status     string
-    LastUsedAt int64
-    Disabled   bool
+// AccountUpdate carries a partial update; nil fields are left unchanged.
+type AccountUpdate struct {
+    Username  *string
+    Password  *string
+    Bandwidth *models.Bandwidth
+    Tags      *[]string
+}
+
+type Accounts struct {
+    db  *sql.DB
+    box *secret.Box
+    mu  sync.Mutex // serializes lease claims on top of the immediate transaction
+
+    Health        HealthPolicy
+    Selection     *Selection
+    Pools         *IfaceMap // per-interface pool rules
+    OnStateChange func(models.StateChange) // called after every committed state change
+}
+
+func NewAccounts(db *sql.DB, box *secret.Box) *Accounts {
+    return &Accounts{db: db, box: box, Health: DefaultHealthPolicy(), Selection: NewSelection(NewSettings(db)), Pools: NewIfaceMap(db)}
+}
+
+const accountColumns = `id, username, password, bandwidth, status, last_used_at, disabled, fail_count, cooldown_until, tags`
+
+type rowScanner interface{ Scan(dest ...any) error }
+
+func scanAccount(r rowScanner) (*models.Account, error) {
+    var x models.Account
+    var disabledInt int
+    var tags string
+    if err := r.Scan(&x.ID, &x.Username, &x.Password, &x.Bandwidth, &x.Status, &x.LastUsedAt, &disabledInt, &x.FailCount, &x.CooldownUntil, &tags); err != nil { return nil, err }
+    x.Disabled = disabledInt != 0
+    x.Tags = splitTags(tags)
+    return &x, nil
+}
+
+// NormalizeTags trims, de-duplicates and drops empty tags; commas split a single entry into several.
+func NormalizeTags(tags []string) []string {
+    out := []string{}
+    seen := map[string]bool{}
+    for _, t := range tags {
+        for _, x := range strings.Split(t, ",") {
+            x = strings.TrimSpace(x)
+            if x == "" || seen[x] { continue }
+            seen[x] = true
+            out = append(out, x)
+        }
+    }
+    return out
 }
 
-type Accounts struct { db *sql.DB }
+func splitTags(s string) []string { return NormalizeTags([]string{s}) }
+func joinTags(tags []string) string { return strings.Join(NormalizeTags(tags), ",") }
 
-func NewAccounts(db *sql.DB) *Accounts { return &Accounts{db: db} }
+func validateAccount(username, password string, bandwidth models.Bandwidth) error {
+    if strings.TrimSpace(username) == "" { return fmt.Errorf("%w: username required", ErrInvalidAccount) }
+    if password == "" { return fmt.Errorf("%w: password required", ErrInvalidAccount) }
+    if !bandwidth.Valid() { return fmt.Errorf("%w: unsupported bandwidth %d", ErrInvalidAccount, bandwidth) }
+    return nil
+}
 
-func (a *Accounts) List(ctx context.Context) ([]Account, error) {
-    rows, err := a.db.QueryContext(ctx, `SELECT id, username, password, bandwidth, status, last_used_at, disabled FROM accounts ORDER BY id ASC`)
+func (a *Accounts) List(ctx context.Context) ([]models.Account, error) {
+    rows, err := a.db.QueryContext(ctx, `SELECT `+accountColumns+` FROM accounts ORDER BY id ASC`)
     if err != nil { return nil, err }
     defer rows.Close()
-    var out []Account
+    var out []models.Account
     for rows.Next() {
-        var x Account
-        var disabledInt int
-        if err := rows.Scan(&x.ID, &x.Username, &x.Password, &x.Bandwidth, &x.Status, &x.LastUsedAt, &disabledInt); err != nil { return nil, err }
-        x.Disabled = disabledInt != 0
-        out = append(out, x)
+        x, err := scanAccount(rows)
+        if err != nil { return nil, err }
+        out = append(out, *x)
     }
     return out, rows.Err()
 }
 
-func (a *Accounts) Add(ctx context.Context, username, password string, bandwidth int) (int64, error) {
-    res, err := a.db.ExecContext(ctx, `INSERT INTO accounts (username, password, bandwidth, status, last_used_at, disabled) VALUES (?, ?, ?, 'IDLE', 0, 0)`, username, password, bandwidth)
+// Get returns the account with the given id, or ErrNotFound.
+func (a *Accounts) Get(ctx context.Context, id int64) (*models.Account, error) {
+    x, err := scanAccount(a.db.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id=?`, id))
+    if errors.Is(err, sql.ErrNoRows) { return nil, ErrNotFound }
+    return x, err
+}
+
+func (a *Accounts) Add(ctx context.Context, username, password string, bandwidth models.Bandwidth, tags []string) (int64, error) {
+    username = strings.TrimSpace(username)
+    if err := validateAccount(username, password, bandwidth); err != nil { return 0, err }
+    sealed, err := a.box.Seal(password)
+    if err != nil { return 0, err }
+    res, err := a.db.ExecContext(ctx, `INSERT INTO accounts (username, password, bandwidth, status, last_used_at, disabled, tags) VALUES (?, ?, ?, 'IDLE', 0, 0, ?)`, username, sealed, bandwidth, joinTags(tags))
+    if errors.Is(err, sqlite3.CONSTRAINT_UNIQUE) { return 0, fmt.Errorf("%w: %s", ErrDuplicate, username) }
     if err != nil { return 0, err }
     return res.LastInsertId()
 }
 
-func (a *Accounts) UpdateState(ctx context.Context, id int64, state string) error {
-    _, err := a.db.ExecContext(ctx, `UPDATE accounts SET status=? WHERE id=?`, state, id)
+// Update applies the non-nil fields of u to the account after validating the result.
+func (a *Accounts) Update(ctx context.Context, id int64, u AccountUpdate) error {
+    cur, err := a.Get(ctx, id)
+    if err != nil { return err }
+    if u.Username != nil { cur.Username = strings.TrimSpace(*u.Username) }
+    if u.Password != nil { cur.Password = *u.Password }
+    if u.Bandwidth != nil { cur.Bandwidth = *u.Bandwidth }
+    if u.Tags != nil { cur.Tags = *u.Tags }
+    if err := validateAccount(cur.Username, cur.Password, cur.Bandwidth); err != nil { return err }
+    if u.Password != nil {
+        if cur.Password, err = a.box.Seal(cur.Password); err != nil { return err }
+    }
+    _, err = a.db.ExecContext(ctx, `UPDATE accounts SET username=?, password=?, bandwidth=?, tags=? WHERE id=?`, cur.Username, cur.Password, cur.Bandwidth, joinTags(cur.Tags), id)
+    if errors.Is(err, sqlite3.CONSTRAINT_UNIQUE) { return fmt.Errorf("%w: %s", ErrDuplicate, cur.Username) }
     return err
 }
 
+// Delete removes an account. Accounts that are ONLINE or leased to a WAN interface are refused with ErrAccountOnline.
+func (a *Accounts) Delete(ctx context.Context, id int64) error {
+    now := time.Now().Unix()
+    res, err := a.db.ExecContext(ctx, `DELETE FROM accounts WHERE id=? AND status <> 'ONLINE'
+        AND id NOT IN (SELECT account_id FROM account_leases WHERE `+heldLease+`)`, id, now)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n > 0 {
+        _, err := a.db.ExecContext(ctx, `DELETE FROM account_leases WHERE account_id=?`, id)
+        return err
+    }
+    if _, err := a.Get(ctx, id); err != nil { return err }
+    return ErrAccountOnline
+}
+
+// SetDisabled toggles the disabled flag. A disabled account is never claimed;
+// its status becomes DISABLED unless it is still in use, in which case only the flag is set.
+// Enabling also clears the failure counter and cooldown, so it doubles as a manual recovery.
+func (a *Accounts) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+    return a.withStates(ctx, func(st *stateTx) error {
+        var status models.AccountState
+        var err error
+        if disabled {
+            err = st.QueryRowContext(ctx, `UPDATE accounts SET disabled=1 WHERE id=? RETURNING status`, id).Scan(&status)
+        } else {
+            err = st.QueryRowContext(ctx, `UPDATE accounts SET disabled=0, fail_count=0, cooldown_until=0 WHERE id=? RETURNING status`, id).Scan(&status)
+        }
+        if errors.Is(err, sql.ErrNoRows) { return ErrNotFound }
+        if err != nil { return err }
+        switch {
+        case disabled && status != models.StateOnline && status != models.StateConnecting:
+            return st.set(ctx, id, models.StateDisabled)
+        case !disabled && (status == models.StateDisabled || status == models.StateFailed):
+            return st.set(ctx, id, models.StateIdle)
+        }
+        return nil
+    })
+}
+
+// Password decrypts the credential of acct. Only the login path should need this.
+// Rows restored from a backup taken before encryption are returned as-is until the next start seals them.
+func (a *Accounts) Password(acct *models.Account) (string, error) {
+    if !secret.IsSealed(acct.Password) { return acct.Password, nil }
+    return a.box.Open(acct.Password)
+}
+
+// SealPlaintext encrypts any password still stored in plaintext and returns how many rows changed.
+func (a *Accounts) SealPlaintext(ctx context.Context) (int, error) {
+    return a.reseal(ctx, func(stored string) (string, bool, error) {
+        if secret.IsSealed(stored) { return "", false, nil }
+        sealed, err := a.box.Seal(stored)
+        return sealed, true, err
+    })
+}
+
+// CheckKey verifies that the configured master key can open the stored passwords.
+func (a *Accounts) CheckKey(ctx context.Context) error {
+    var stored string
+    err := a.db.QueryRowContext(ctx, `SELECT password FROM accounts WHERE password LIKE 'enc:%' LIMIT 1`).Scan(&stored)
+    if errors.Is(err, sql.ErrNoRows) { return nil }
+    if err != nil { return err }
+    _, err = a.box.Open(stored)
+    return err
+}
+
+// Rekey re-encrypts every password under next. On success the receiver switches to next as well.
+func (a *Accounts) Rekey(ctx context.Context, next *secret.Box) (int, error) {
+    n, err := a.reseal(ctx, func(stored string) (string, bool, error) {
+        plain := stored
+        if secret.IsSealed(stored) {
+            var err error
+            if plain, err = a.box.Open(stored); err != nil { return "", false, err }
+        }
+        sealed, err := next.Seal(plain)
+        return sealed, true, err
+    })
+    if err == nil { a.box = next }
+    return n, err
+}
+
+// reseal rewrites stored passwords in a single transaction using fn.
+func (a *Accounts) reseal(ctx context.Context, fn func(stored string) (string, bool, error)) (int, error) {
+    tx, err := a.db.BeginTx(ctx, nil)
+    if err != nil { return 0, err }
+    defer tx.Rollback()
+    rows, err := tx.QueryContext(ctx, `SELECT id, password FROM accounts`)
+    if err != nil { return 0, err }
+    updates := map[int64]string{}
+    for rows.Next() {
+        var id int64
+        var stored string
+        if err := rows.Scan(&id, &stored); err != nil { rows.Close(); return 0, err }
+        v, changed, err := fn(stored)
+        if err != nil { rows.Close(); return 0, fmt.Errorf("account %d: %w", id, err) }
+        if changed { updates[id] = v }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil { return 0, err }
+    for id, v := range updates {
+        if _, err := tx.ExecContext(ctx, `UPDATE accounts SET password=? WHERE id=?`, v, id); err != nil { return 0, err }
+    }
+    return len(updates), tx.Commit()
+}
+
 func (a *Accounts) MarkUsedNow(ctx context.Context, id int64) error {
     _, err := a.db.ExecContext(ctx, `UPDATE accounts SET last_used_at=? WHERE id=?`, time.Now().Unix(), id)
     return err
 }
 
-// NextCandidate selects the next account according to rules:
+// candidateQuery lists the accounts eligible for a login:
 // - not disabled
-// - prefer higher bandwidth
-// - prefer longer time since last_used_at
-// - ignore FAILED accounts by default
-func (a *Accounts) NextCandidate(ctx context.Context) (*Account, error) {
-    row := a.db.QueryRowContext(ctx, `
-        SELECT id, username, password, bandwidth, status, last_used_at, disabled
+// - not ONLINE or CONNECTING, even if their lease has run out
+// - not leased to any WAN interface
+// - ignore FAILED accounts until their cooldown expires
+// ordered by higher bandwidth, then longer time since last_used_at. The Selector makes the final pick.
+const candidateQuery = `
+        SELECT ` + accountColumns + `
         FROM accounts
-        WHERE disabled=0 AND status <> 'FAILED'
-        ORDER BY bandwidth DESC, CASE last_used_at WHEN 0 THEN -9223372036854775808 ELSE last_used_at END ASC
-        LIMIT 1`)
-    var x Account
-    var disabledInt int
-    if err := row.Scan(&x.ID, &x.Username, &x.Password, &x.Bandwidth, &x.Status, &x.LastUsedAt, &disabledInt); err != nil {
-        if errors.Is(err, sql.ErrNoRows) { return nil, nil }
-        return nil, err
+        WHERE disabled=0 AND status NOT IN ('ONLINE', 'CONNECTING') AND (status <> 'FAILED' OR cooldown_until <= ?)
+            AND id NOT IN (SELECT account_id FROM account_leases WHERE expires_at > ?)
+        ORDER BY bandwidth DESC, CASE last_used_at WHEN 0 THEN -9223372036854775808 ELSE last_used_at END ASC`
+
+type querier interface {
+    QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func candidates(ctx context.Context, q querier, now time.Time) ([]models.Account, error) {
+    rows, err := q.QueryContext(ctx, candidateQuery, now.Unix(), now.Unix())
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []models.Account
+    for rows.Next() {
+        x, err := scanAccount(rows)
+        if err != nil { return nil, err }
+        out = append(out, *x)
     }
-    x.Disabled = disabledInt != 0
-    return &x, nil
+    return out, rows.Err()
+}
+
+// Import modes for duplicate usernames.
+const (
+    ImportSkip  = "skip"
+    ImportMerge = "merge"
+)
+
+type ImportRow struct {
+    Row       int // position in the source file, echoed back in the report
+    Username  string
+    Password  string
+    Bandwidth models.Bandwidth
+    Tags      []string // nil keeps the stored tags when merging
+}
+
+type ImportResult struct {
+    Row      int
+    Username string
+    Action   string // created, updated, skipped or error
+    Error    string
+}
+
+// Import adds rows in a single transaction and reports the outcome of each one. Invalid rows
+// are reported and skipped rather than aborting the import. Rows whose username already exists
+// are skipped (ImportSkip) or have their password and bandwidth overwritten (ImportMerge); an
+// empty password in merge mode keeps the stored one.
+func (a *Accounts) Import(ctx context.Context, rows []ImportRow, mode string) ([]ImportResult, error) {
+    if mode != ImportSkip && mode != ImportMerge { return nil, fmt.Errorf("%w: unknown import mode %q", ErrInvalidAccount, mode) }
+    tx, err := a.db.BeginTx(ctx, nil)
+    if err != nil { return nil, err }
+    defer tx.Rollback()
+    out := make([]ImportResult, 0, len(rows))
+    for _, row := range rows {
+        res := ImportResult{Row: row.Row, Username: strings.TrimSpace(row.Username)}
+        row.Username = res.Username
+        action, err := a.importRow(ctx, tx, row, mode)
+        if err != nil {
+            if !errors.Is(err, ErrInvalidAccount) { return nil, err }
+            res.Action, res.Error = "error", err.Error()
+        } else {
+            res.Action = action
+        }
+        out = append(out, res)
+    }
+    return out, tx.Commit()
 }
 
+func (a *Accounts) importRow(ctx context.Context, tx *sql.Tx, row ImportRow, mode string) (string, error) {
+    var id int64
+    var stored, storedTags string
+    err := tx.QueryRowContext(ctx, `SELECT id, password, tags FROM accounts WHERE username=? ORDER BY id LIMIT 1`, row.Username).Scan(&id, &stored, &storedTags)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) { return "", err }
+    exists := err == nil
+    if exists && mode == ImportSkip { return "skipped", nil }
+    tags := joinTags(row.Tags)
+    if exists && row.Tags == nil { tags = storedTags }
+    if exists && row.Password == "" {
+        if err := validateAccount(row.Username, stored, row.Bandwidth); err != nil { return "", err }
+        _, err := tx.ExecContext(ctx, `UPDATE accounts SET bandwidth=?, tags=? WHERE id=?`, row.Bandwidth, tags, id)
+        return "updated", err
+    }
+    if err := validateAccount(row.Username, row.Password, row.Bandwidth); err != nil { return "", err }
+    sealed, err := a.box.Seal(row.Password)
+    if err != nil { return "", err }
+    if exists {
+        _, err := tx.ExecContext(ctx, `UPDATE accounts SET password=?, bandwidth=?, tags=? WHERE id=?`, sealed, row.Bandwidth, tags, id)
+        return "updated", err
+    }
+    _, err = tx.ExecContext(ctx, `INSERT INTO accounts (username, password, bandwidth, status, last_used_at, disabled, tags) VALUES (?, ?, ?, 'IDLE', 0, 0, ?)`,
+        row.Username, sealed, row.Bandwidth, tags)
+    return "created", err
+}
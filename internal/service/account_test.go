@@ -0,0 +1,23 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+func TestAccountUsernameConflict(t *testing.T) {
+    ctx := context.Background()
+    a := newTestAccounts(t, openTestDB(t))
+    id, err := a.Add(ctx, "2020100001", "secret", models.BW50, nil)
+    if err != nil { t.Fatal(err) }
+    other, err := a.Add(ctx, "2020100002", "secret", models.BW50, nil)
+    if err != nil { t.Fatal(err) }
+
+    if _, err := a.Add(ctx, " 2020100001 ", "other", models.BW20, nil); !errors.Is(err, ErrDuplicate) { t.Fatalf("add duplicate = %v, want ErrDuplicate", err) }
+    name := "2020100001"
+    if err := a.Update(ctx, other, AccountUpdate{Username: &name}); !errors.Is(err, ErrDuplicate) { t.Fatalf("rename to a taken username = %v, want ErrDuplicate", err) }
+    if err := a.Update(ctx, id, AccountUpdate{Username: &name}); err != nil { t.Fatalf("update keeping the username: %v", err) }
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "time"
+)
+
+type AuditEntry struct {
+    ID     int64
+    At     int64 // unix seconds
+    Action string
+    Target string
+    Remote string
+    Detail string
+}
+
+// Audit is an append-only log of sensitive operations such as revealing a password.
+type Audit struct { db *sql.DB }
+
+func NewAudit(db *sql.DB) *Audit { return &Audit{db: db} }
+
+func (a *Audit) Record(ctx context.Context, action, target, remote, detail string) error {
+    _, err := a.db.ExecContext(ctx, `INSERT INTO audit_log (at, action, target, remote, detail) VALUES (?, ?, ?, ?, ?)`,
+        time.Now().Unix(), action, target, remote, detail)
+    return err
+}
+
+// List returns the most recent entries first.
+func (a *Audit) List(ctx context.Context, limit int) ([]AuditEntry, error) {
+    if limit <= 0 { limit = 100 }
+    rows, err := a.db.QueryContext(ctx, `SELECT id, at, action, target, remote, detail FROM audit_log ORDER BY id DESC LIMIT ?`, limit)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []AuditEntry
+    for rows.Next() {
+        var e AuditEntry
+        if err := rows.Scan(&e.ID, &e.At, &e.Action, &e.Target, &e.Remote, &e.Detail); err != nil { return nil, err }
+        out = append(out, e)
+    }
+    return out, rows.Err()
+}
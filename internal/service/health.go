@@ -0,0 +1,83 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+// HealthPolicy decides when repeated login failures take an account out of rotation.
+type HealthPolicy struct {
+    FailThreshold int           // consecutive failures before the account becomes FAILED
+    Cooldown      time.Duration // cooldown after reaching the threshold; doubles with each further failure
+    MaxCooldown   time.Duration
+}
+
+func DefaultHealthPolicy() HealthPolicy {
+    return HealthPolicy{FailThreshold: 3, Cooldown: 5 * time.Minute, MaxCooldown: 6 * time.Hour}
+}
+
+// cooldown returns the cooldown for the given consecutive failure count, or 0 below the threshold.
+func (p HealthPolicy) cooldown(failCount int) time.Duration {
+    threshold := p.FailThreshold
+    if threshold <= 0 { threshold = 1 }
+    if failCount < threshold { return 0 }
+    d := p.Cooldown
+    for i := threshold; i < failCount && (p.MaxCooldown <= 0 || d < p.MaxCooldown); i++ { d *= 2 }
+    if p.MaxCooldown > 0 && d > p.MaxCooldown { d = p.MaxCooldown }
+    return d
+}
+
+// RecordFailure bumps the consecutive failure counter and moves the account to RETRYING, or to
+// FAILED with an exponential cooldown once the threshold is reached. It returns the new state.
+func (a *Accounts) RecordFailure(ctx context.Context, id int64) (models.AccountState, error) {
+    var state models.AccountState
+    err := a.withStates(ctx, func(st *stateTx) error {
+        var n int
+        err := st.QueryRowContext(ctx, `UPDATE accounts SET fail_count=fail_count+1 WHERE id=? RETURNING fail_count`, id).Scan(&n)
+        if errors.Is(err, sql.ErrNoRows) { return ErrNotFound }
+        if err != nil { return err }
+        state = models.StateRetrying
+        until := int64(0)
+        if d := a.Health.cooldown(n); d > 0 {
+            state, until = models.StateFailed, time.Now().Add(d).Unix()
+        }
+        if _, err := st.ExecContext(ctx, `UPDATE accounts SET cooldown_until=? WHERE id=?`, until, id); err != nil { return err }
+        return st.set(ctx, id, state)
+    })
+    return state, err
+}
+
+// RecordPermanentFailure takes the account out of rotation until it is enabled again by hand,
+// for failures that will not go away by themselves (wrong password, arrears): it is disabled and
+// becomes DISABLED.
+func (a *Accounts) RecordPermanentFailure(ctx context.Context, id int64) error {
+    return a.withStates(ctx, func(st *stateTx) error {
+        res, err := st.ExecContext(ctx, `UPDATE accounts SET fail_count=fail_count+1, cooldown_until=0, disabled=1 WHERE id=?`, id)
+        if err != nil { return err }
+        if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+        return st.set(ctx, id, models.StateDisabled)
+    })
+}
+
+// RecordSuccess resets the failure counter and cooldown.
+func (a *Accounts) RecordSuccess(ctx context.Context, id int64) error {
+    _, err := a.db.ExecContext(ctx, `UPDATE accounts SET fail_count=0, cooldown_until=0 WHERE id=?`, id)
+    return err
+}
+
+// recoverCooledDown returns FAILED accounts whose cooldown has expired to IDLE. The failure
+// counter is kept, so another failure sends the account straight back with a longer cooldown.
+func recoverCooledDown(ctx context.Context, st *stateTx, now time.Time) error {
+    rows, err := st.QueryContext(ctx, `SELECT id FROM accounts WHERE status='FAILED' AND cooldown_until <= ?`, now.Unix())
+    if err != nil { return err }
+    ids, err := scanIDs(rows)
+    if err != nil { return err }
+    for _, id := range ids {
+        if err := st.set(ctx, id, models.StateIdle); err != nil { return err }
+    }
+    return nil
+}
@@ -3,8 +3,14 @@ package service
 import (
     "context"
     "database/sql"
+    "errors"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
 )
 
+// ErrIfaceNotMapped is returned for interfaces without a NIC mapping.
+var ErrIfaceNotMapped = errors.New("interface not mapped")
+
 type IfaceMap struct { db *sql.DB }
 
 func NewIfaceMap(db *sql.DB) *IfaceMap { return &IfaceMap{db: db} }
@@ -42,3 +48,42 @@ func (m *IfaceMap) All(ctx context.Context) (map[string]string, error) {
     return out, rows.Err()
 }
 
+
+// PoolRule restricts which accounts may be claimed for an interface. An empty Tags list means
+// every account is eligible; with Fallback set, the global pool is used when no tagged account
+// is available.
+type PoolRule struct {
+    Tags     []string `json:"tags"`
+    Fallback bool     `json:"fallback"`
+}
+
+// Filter narrows candidates to the rule's pool, keeping their order.
+func (p PoolRule) Filter(list []models.Account) []models.Account {
+    if len(p.Tags) == 0 { return list }
+    var out []models.Account
+    for i := range list {
+        if list[i].HasAnyTag(p.Tags) { out = append(out, list[i]) }
+    }
+    if len(out) == 0 && p.Fallback { return list }
+    return out
+}
+
+// Pool returns the pool rule for wanIface; unmapped interfaces use the global pool.
+func (m *IfaceMap) Pool(ctx context.Context, wanIface string) (PoolRule, error) {
+    var tags string
+    var fallback int
+    err := m.db.QueryRowContext(ctx, `SELECT pool_tags, pool_fallback FROM iface_map WHERE wan_iface=?`, wanIface).Scan(&tags, &fallback)
+    if errors.Is(err, sql.ErrNoRows) { return PoolRule{Tags: []string{}}, nil }
+    if err != nil { return PoolRule{}, err }
+    return PoolRule{Tags: splitTags(tags), Fallback: fallback != 0}, nil
+}
+
+// SetPool stores the pool rule for an already mapped interface.
+func (m *IfaceMap) SetPool(ctx context.Context, wanIface string, p PoolRule) error {
+    fallback := 0
+    if p.Fallback { fallback = 1 }
+    res, err := m.db.ExecContext(ctx, `UPDATE iface_map SET pool_tags=?, pool_fallback=? WHERE wan_iface=?`, joinTags(p.Tags), fallback, wanIface)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrIfaceNotMapped }
+    return nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "slices"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+// Lease binds an account to the WAN interface it is logged in on.
+type Lease struct {
+    AccountID  int64
+    WanIface   string
+    AcquiredAt int64 // unix seconds
+    ExpiresAt  int64
+}
+
+// heldLease matches leases that still hold their account: unexpired ones, and any lease of an
+// account that is ONLINE or CONNECTING, whose expiry only means it was not renewed lately.
+const heldLease = `(expires_at > ? OR account_id IN (SELECT id FROM accounts WHERE status IN ('ONLINE', 'CONNECTING')))`
+
+// Claim atomically picks the next candidate for wanIface from the interface's pool using the
+// configured Selector, leases it for ttl and marks it CONNECTING. Accounts leased to other
+// interfaces, whatever their state, and those listed in exclude (e.g. already tried in this
+// failover) are skipped. The interface's previous lease, if any, is dropped because a new login
+// replaces that session. It returns nil, nil when no account is available.
+func (a *Accounts) Claim(ctx context.Context, wanIface string, ttl time.Duration, exclude ...int64) (*models.Account, error) {
+    sel, err := a.Selection.For(ctx, wanIface)
+    if err != nil { return nil, err }
+    rule, err := a.Pools.Pool(ctx, wanIface)
+    if err != nil { return nil, err }
+    a.mu.Lock(); defer a.mu.Unlock()
+    var claimed *models.Account
+    err = a.withStates(ctx, func(st *stateTx) error {
+        now := time.Now()
+        var prev int64
+        err := st.QueryRowContext(ctx, `DELETE FROM account_leases WHERE wan_iface=? RETURNING account_id`, wanIface).Scan(&prev)
+        if err != nil && !errors.Is(err, sql.ErrNoRows) { return err }
+        if err == nil {
+            var status models.AccountState
+            if err := st.QueryRowContext(ctx, `SELECT status FROM accounts WHERE id=?`, prev).Scan(&status); err != nil && !errors.Is(err, sql.ErrNoRows) { return err }
+            if status == models.StateOnline {
+                if err := st.set(ctx, prev, models.StateIdle); err != nil { return err }
+            }
+        }
+        if _, err := st.ExecContext(ctx, `DELETE FROM account_leases WHERE NOT `+heldLease, now.Unix()); err != nil { return err }
+
+        if err := recoverCooledDown(ctx, st, now); err != nil { return err }
+        list, err := candidates(ctx, st, now)
+        if err != nil { return err }
+        list = slices.DeleteFunc(list, func(x models.Account) bool { return slices.Contains(exclude, x.ID) })
+        if list = rule.Filter(list); len(list) == 0 { return nil }
+        x := sel.Select(wanIface, list)
+        if _, err := st.ExecContext(ctx, `INSERT INTO account_leases (account_id, wan_iface, acquired_at, expires_at) VALUES (?, ?, ?, ?)`,
+            x.ID, wanIface, now.Unix(), now.Add(ttl).Unix()); err != nil { return err }
+        if err := st.set(ctx, x.ID, models.StateConnecting); err != nil { return err }
+        x.Status = models.StateConnecting
+        claimed = x
+        return nil
+    })
+    if err != nil { return nil, err }
+    return claimed, nil
+}
+
+// Renew extends the lease accountID holds on wanIface, e.g. once the login succeeded. It fails
+// with ErrNotFound when the account is no longer leased to wanIface.
+func (a *Accounts) Renew(ctx context.Context, wanIface string, accountID int64, ttl time.Duration) error {
+    res, err := a.db.ExecContext(ctx, `UPDATE account_leases SET expires_at=? WHERE account_id=? AND wan_iface=?`, time.Now().Add(ttl).Unix(), accountID, wanIface)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+// RenewIface extends the lease of the ONLINE account on wanIface, e.g. after a healthy monitor
+// round, so a long-lived session never outlasts its lease. Nothing happens without one.
+func (a *Accounts) RenewIface(ctx context.Context, wanIface string, ttl time.Duration) error {
+    _, err := a.db.ExecContext(ctx, `UPDATE account_leases SET expires_at=? WHERE wan_iface=?
+        AND account_id IN (SELECT id FROM accounts WHERE status='ONLINE')`, time.Now().Add(ttl).Unix(), wanIface)
+    return err
+}
+
+// Release drops the lease held by accountID; releasing an unleased account is not an error.
+func (a *Accounts) Release(ctx context.Context, accountID int64) error {
+    _, err := a.db.ExecContext(ctx, `DELETE FROM account_leases WHERE account_id=?`, accountID)
+    return err
+}
+
+// LeaseFor returns the lease held on wanIface, or nil if there is none.
+func (a *Accounts) LeaseFor(ctx context.Context, wanIface string) (*Lease, error) {
+    var l Lease
+    err := a.db.QueryRowContext(ctx, `SELECT account_id, wan_iface, acquired_at, expires_at FROM account_leases WHERE wan_iface=? AND `+heldLease,
+        wanIface, time.Now().Unix()).Scan(&l.AccountID, &l.WanIface, &l.AcquiredAt, &l.ExpiresAt)
+    if errors.Is(err, sql.ErrNoRows) { return nil, nil }
+    if err != nil { return nil, err }
+    return &l, nil
+}
+
+// Leases lists all held leases.
+func (a *Accounts) Leases(ctx context.Context) ([]Lease, error) {
+    rows, err := a.db.QueryContext(ctx, `SELECT account_id, wan_iface, acquired_at, expires_at FROM account_leases WHERE `+heldLease+` ORDER BY wan_iface`, time.Now().Unix())
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Lease
+    for rows.Next() {
+        var l Lease
+        if err := rows.Scan(&l.AccountID, &l.WanIface, &l.AcquiredAt, &l.ExpiresAt); err != nil { return nil, err }
+        out = append(out, l)
+    }
+    return out, rows.Err()
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/db"
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+    "github.com/Sleepstars/SZU-NetManager/internal/secret"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+    t.Helper()
+    database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+    if err != nil { t.Fatal(err) }
+    t.Cleanup(func() { database.Close() })
+    if err := db.Migrate(database); err != nil { t.Fatal(err) }
+    return database
+}
+
+func newTestAccounts(t *testing.T, database *sql.DB) *Accounts {
+    t.Helper()
+    box, err := secret.New([]byte("test key"))
+    if err != nil { t.Fatal(err) }
+    return NewAccounts(database, box)
+}
+
+func addTestAccounts(t *testing.T, a *Accounts, n int) {
+    t.Helper()
+    for i := 0; i < n; i++ {
+        if _, err := a.Add(context.Background(), fmt.Sprintf("20201%05d", i), "secret", models.BW50, nil); err != nil { t.Fatal(err) }
+    }
+}
+
+// Interfaces claiming at once, through two Accounts as two processes would, never share an account.
+func TestClaimConcurrent(t *testing.T) {
+    database := openTestDB(t)
+    owners := []*Accounts{newTestAccounts(t, database), newTestAccounts(t, database)}
+    addTestAccounts(t, owners[0], 3)
+
+    const ifaces = 8
+    got := make([]*models.Account, ifaces)
+    errs := make([]error, ifaces)
+    var wg sync.WaitGroup
+    for i := 0; i < ifaces; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            got[i], errs[i] = owners[i%2].Claim(context.Background(), fmt.Sprintf("wan%d", i), time.Minute)
+        }(i)
+    }
+    wg.Wait()
+
+    seen := map[int64]string{}
+    for i, x := range got {
+        if errs[i] != nil { t.Fatalf("wan%d: %v", i, errs[i]) }
+        if x == nil { continue }
+        if other, ok := seen[x.ID]; ok { t.Fatalf("account %d claimed by %s and wan%d", x.ID, other, i) }
+        seen[x.ID] = fmt.Sprintf("wan%d", i)
+    }
+    if len(seen) != 3 { t.Fatalf("claimed %d accounts, want 3", len(seen)) }
+    leases, err := owners[0].Leases(context.Background())
+    if err != nil { t.Fatal(err) }
+    if len(leases) != 3 { t.Fatalf("%d leases, want 3", len(leases)) }
+}
+
+// An ONLINE account whose lease ran out still belongs to its interface.
+func TestClaimSkipsExpiredOnlineLease(t *testing.T) {
+    ctx := context.Background()
+    database := openTestDB(t)
+    a := newTestAccounts(t, database)
+    addTestAccounts(t, a, 1)
+
+    x, err := a.Claim(ctx, "wan", time.Minute)
+    if err != nil || x == nil { t.Fatalf("claim: %v, %v", x, err) }
+    if err := a.Transition(ctx, x.ID, models.StateOnline); err != nil { t.Fatal(err) }
+    if _, err := database.Exec(`UPDATE account_leases SET expires_at=?`, time.Now().Add(-time.Hour).Unix()); err != nil { t.Fatal(err) }
+
+    if y, err := a.Claim(ctx, "wanb", time.Minute); err != nil || y != nil { t.Fatalf("wanb claimed %v (%v)", y, err) }
+    if l, err := a.LeaseFor(ctx, "wan"); err != nil || l == nil || l.AccountID != x.ID { t.Fatalf("lease on wan = %+v (%v)", l, err) }
+
+    if err := a.RenewIface(ctx, "wan", time.Hour); err != nil { t.Fatal(err) }
+    l, err := a.LeaseFor(ctx, "wan")
+    if err != nil || l == nil || l.ExpiresAt <= time.Now().Unix() { t.Fatalf("renewed lease = %+v (%v)", l, err) }
+
+    // re-claiming on the same interface replaces its own session
+    y, err := a.Claim(ctx, "wan", time.Minute)
+    if err != nil || y == nil || y.ID != x.ID { t.Fatalf("re-claim on wan = %v (%v)", y, err) }
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "net/url"
+    "time"
+)
+
+// Probe types.
+const (
+    ProbeHTTP = "http"
+    ProbeTCP  = "tcp"
+    ProbeDNS  = "dns"
+    ProbePing = "ping"
+)
+
+// DefaultProbeTimeout bounds a probe that does not set its own timeout.
+const DefaultProbeTimeout = 5 * time.Second
+
+// ProbeSpec describes one health check of an interface. An interface is healthy when any of
+// its probes passes.
+type ProbeSpec struct {
+    Type       string `json:"type"`
+    Target     string `json:"target"`                // URL (http), host:port (tcp), name (dns) or host (ping)
+    TimeoutSec int    `json:"timeout_sec,omitempty"` // DefaultProbeTimeout when 0
+    Status     int    `json:"status,omitempty"`      // http: expected status code; any 2xx when 0
+    Body       string `json:"body,omitempty"`        // http: text the response body must contain
+    Resolver   string `json:"resolver,omitempty"`    // dns: server to ask (host[:port]); system resolver when empty
+}
+
+func (p ProbeSpec) Timeout() time.Duration {
+    if p.TimeoutSec == 0 { return DefaultProbeTimeout }
+    return time.Duration(p.TimeoutSec) * time.Second
+}
+
+// Local reports whether the probe runs on the backend host bound to the NIC (tcp, dns). That is
+// impossible when the NICs are router devices.
+func (p ProbeSpec) Local() bool { return p.Type == ProbeTCP || p.Type == ProbeDNS }
+
+// LocalProbeError rejects tcp and dns probes when interfaces are probed from the router.
+func LocalProbeError(typ string) error {
+    return fmt.Errorf("%w: %s probes run on the backend host and are not available with NM_MONITOR_MODE=router", ErrInvalidSettings, typ)
+}
+
+// Validate checks the probe's target against its type.
+func (p ProbeSpec) Validate() error {
+    if p.Target == "" { return fmt.Errorf("%w: probe target required", ErrInvalidSettings) }
+    if p.TimeoutSec < 0 || p.TimeoutSec > 60 { return fmt.Errorf("%w: probe timeout must be between 1 and 60 seconds, or 0 for the default", ErrInvalidSettings) }
+    switch p.Type {
+    case ProbeHTTP:
+        u, err := url.Parse(p.Target)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" { return fmt.Errorf("%w: invalid probe url %q", ErrInvalidSettings, p.Target) }
+        if p.Status != 0 && (p.Status < 100 || p.Status > 599) { return fmt.Errorf("%w: invalid expected status %d", ErrInvalidSettings, p.Status) }
+    case ProbeTCP:
+        if _, _, err := net.SplitHostPort(p.Target); err != nil { return fmt.Errorf("%w: tcp probe target must be host:port", ErrInvalidSettings) }
+    case ProbeDNS, ProbePing:
+    default:
+        return fmt.Errorf("%w: unknown probe type %q", ErrInvalidSettings, p.Type)
+    }
+    return nil
+}
+
+// Probes stores the probes configured per interface in the kv table. With Router set the
+// interfaces are probed from the router, so local probes are refused.
+type Probes struct {
+    settings *Settings
+    Router   bool
+}
+
+func NewProbes(settings *Settings) *Probes { return &Probes{settings: settings} }
+
+func probesKey(wanIface string) string { return "probes/" + wanIface }
+
+// Get returns the probes of wanIface; none means the monitor's default probe.
+func (p *Probes) Get(ctx context.Context, wanIface string) ([]ProbeSpec, error) {
+    var specs []ProbeSpec
+    _, err := p.settings.Get(ctx, probesKey(wanIface), &specs)
+    return specs, err
+}
+
+// Set replaces the probes of wanIface; an empty list restores the default.
+func (p *Probes) Set(ctx context.Context, wanIface string, specs []ProbeSpec) error {
+    for _, s := range specs {
+        if err := s.Validate(); err != nil { return err }
+        if p.Router && s.Local() { return LocalProbeError(s.Type) }
+    }
+    if specs == nil { specs = []ProbeSpec{} }
+    return p.settings.Set(ctx, probesKey(wanIface), specs)
+}
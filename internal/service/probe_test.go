@@ -0,0 +1,20 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestProbesRouterMode(t *testing.T) {
+    p := NewProbes(NewSettings(openTestDB(t)))
+    ctx := context.Background()
+    specs := []ProbeSpec{{Type: ProbeHTTP, Target: "http://example.com/"}, {Type: ProbeTCP, Target: "114.114.114.114:53"}}
+    if err := p.Set(ctx, "wanb", specs); err != nil { t.Fatalf("local mode: %v", err) }
+
+    p.Router = true
+    for _, s := range []ProbeSpec{{Type: ProbeTCP, Target: "114.114.114.114:53"}, {Type: ProbeDNS, Target: "www.baidu.com"}} {
+        if err := p.Set(ctx, "wanb", []ProbeSpec{s}); !errors.Is(err, ErrInvalidSettings) { t.Errorf("%s probe in router mode = %v, want ErrInvalidSettings", s.Type, err) }
+    }
+    if err := p.Set(ctx, "wanb", []ProbeSpec{{Type: ProbePing, Target: "223.5.5.5"}}); err != nil { t.Fatalf("ping in router mode: %v", err) }
+}
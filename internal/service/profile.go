@@ -0,0 +1,73 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "net"
+    "time"
+)
+
+var ErrInvalidProfile = errors.New("invalid login profile")
+
+// Portal areas.
+const (
+    AreaTeaching  = "teaching"
+    AreaDormitory = "dormitory"
+)
+
+// DefaultLoginTimeout bounds a single login attempt when the profile does not set one.
+const DefaultLoginTimeout = 40 * time.Second
+
+// LoginProfile holds how an interface logs in. Zero values fall back to the defaults: the
+// default authenticator, its own portal host, the teaching area and an IP detected on the router.
+type LoginProfile struct {
+    WanIface      string
+    Authenticator string
+    Host          string // portal host override
+    Area          string // AreaTeaching or AreaDormitory
+    BindIP        string // IP reported to the portal at login; detected from the router when empty
+    Timeout       time.Duration
+    Retries       int // extra attempts with the same account after a timeout or unreachable portal
+}
+
+func (x LoginProfile) Teaching() bool { return x.Area != AreaDormitory }
+
+// Validate checks the profile's fields and fills in defaults.
+func (x *LoginProfile) Validate() error {
+    if x.WanIface == "" { return fmt.Errorf("%w: interface required", ErrInvalidProfile) }
+    if x.Area == "" { x.Area = AreaTeaching }
+    if x.Area != AreaTeaching && x.Area != AreaDormitory { return fmt.Errorf("%w: area must be %s or %s", ErrInvalidProfile, AreaTeaching, AreaDormitory) }
+    if x.BindIP != "" && net.ParseIP(x.BindIP) == nil { return fmt.Errorf("%w: invalid bind ip %q", ErrInvalidProfile, x.BindIP) }
+    if x.Timeout == 0 { x.Timeout = DefaultLoginTimeout }
+    if x.Timeout < time.Second || x.Timeout > 5*time.Minute { return fmt.Errorf("%w: timeout must be between 1s and 5m", ErrInvalidProfile) }
+    if x.Retries < 0 || x.Retries > 5 { return fmt.Errorf("%w: retries must be between 0 and 5", ErrInvalidProfile) }
+    return nil
+}
+
+type Profiles struct { db *sql.DB }
+
+func NewProfiles(db *sql.DB) *Profiles { return &Profiles{db: db} }
+
+// Get returns the profile of wanIface with defaults applied; interfaces without one get the defaults.
+func (p *Profiles) Get(ctx context.Context, wanIface string) (LoginProfile, error) {
+    x := LoginProfile{WanIface: wanIface}
+    var timeout int
+    err := p.db.QueryRowContext(ctx, `SELECT authenticator, host, area, bind_ip, timeout_sec, retries FROM login_profiles WHERE wan_iface=?`, wanIface).
+        Scan(&x.Authenticator, &x.Host, &x.Area, &x.BindIP, &timeout, &x.Retries)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) { return x, err }
+    x.Timeout = time.Duration(timeout) * time.Second
+    if x.Area == "" { x.Area = AreaTeaching }
+    if x.Timeout == 0 { x.Timeout = DefaultLoginTimeout }
+    return x, nil
+}
+
+func (p *Profiles) Set(ctx context.Context, x LoginProfile) error {
+    if err := x.Validate(); err != nil { return err }
+    _, err := p.db.ExecContext(ctx, `INSERT INTO login_profiles (wan_iface, authenticator, host, area, bind_ip, timeout_sec, retries) VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(wan_iface) DO UPDATE SET authenticator=excluded.authenticator, host=excluded.host, area=excluded.area,
+            bind_ip=excluded.bind_ip, timeout_sec=excluded.timeout_sec, retries=excluded.retries`,
+        x.WanIface, x.Authenticator, x.Host, x.Area, x.BindIP, int(x.Timeout/time.Second), x.Retries)
+    return err
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "math/rand/v2"
+    "sort"
+    "sync"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+// Selector picks the account to log in with from the eligible candidates for a WAN interface.
+// Candidates arrive ordered by bandwidth (desc) and then least recently used; the slice is never empty.
+type Selector interface {
+    Select(wanIface string, candidates []models.Account) *models.Account
+}
+
+// Built-in strategy names.
+const (
+    StrategyLRU            = "lru"
+    StrategyRoundRobin     = "round-robin"
+    StrategyWeightedRandom = "weighted-random"
+    StrategyPriority       = "priority"
+)
+
+// Strategies lists the built-in strategy names.
+func Strategies() []string {
+    return []string{StrategyLRU, StrategyRoundRobin, StrategyWeightedRandom, StrategyPriority}
+}
+
+// LRU prefers the highest bandwidth, then the account unused for the longest time.
+type LRU struct{}
+
+func (LRU) Select(_ string, c []models.Account) *models.Account { return &c[0] }
+
+// RoundRobin walks the pool in id order, continuing after the last account it handed out.
+type RoundRobin struct {
+    mu   sync.Mutex
+    last int64
+}
+
+func (r *RoundRobin) Select(_ string, c []models.Account) *models.Account {
+    r.mu.Lock(); defer r.mu.Unlock()
+    byID := append([]models.Account(nil), c...)
+    sort.Slice(byID, func(i, j int) bool { return byID[i].ID < byID[j].ID })
+    pick := byID[0]
+    for _, x := range byID {
+        if x.ID > r.last { pick = x; break }
+    }
+    r.last = pick.ID
+    return &pick
+}
+
+// WeightedRandom picks randomly with probability proportional to bandwidth, spreading use
+// across account owners instead of always draining the fastest account.
+type WeightedRandom struct{}
+
+func (WeightedRandom) Select(_ string, c []models.Account) *models.Account {
+    total := 0
+    for _, x := range c { total += int(x.Bandwidth) }
+    if total <= 0 { return &c[rand.IntN(len(c))] }
+    n := rand.IntN(total)
+    for i := range c {
+        n -= int(c[i].Bandwidth)
+        if n < 0 { return &c[i] }
+    }
+    return &c[len(c)-1]
+}
+
+// Priority follows a fixed list of usernames; accounts not on the list come last in LRU order.
+type Priority struct{ Usernames []string }
+
+func (p Priority) Select(_ string, c []models.Account) *models.Account {
+    for _, u := range p.Usernames {
+        for i := range c {
+            if c[i].Username == u { return &c[i] }
+        }
+    }
+    return &c[0]
+}
+
+// SelectionSettings chooses a strategy globally and optionally per WAN interface.
+type SelectionSettings struct {
+    Default  string            `json:"default"`
+    PerIface map[string]string `json:"per_iface"`
+    Priority []string          `json:"priority"` // usernames, used by the priority strategy
+}
+
+const selectionKey = "selection"
+
+// Validate checks that every strategy name is known.
+func (s SelectionSettings) Validate() error {
+    names := []string{s.Default}
+    for _, n := range s.PerIface { names = append(names, n) }
+    for _, n := range names {
+        if n == "" { continue }
+        known := false
+        for _, k := range Strategies() { known = known || k == n }
+        if !known { return fmt.Errorf("%w: unknown selection strategy %q", ErrInvalidSettings, n) }
+    }
+    return nil
+}
+
+// Selection resolves the configured Selector for each WAN interface.
+type Selection struct {
+    settings *Settings
+    rr       RoundRobin // shared so the cursor survives settings changes
+}
+
+func NewSelection(settings *Settings) *Selection { return &Selection{settings: settings} }
+
+func (s *Selection) Settings(ctx context.Context) (SelectionSettings, error) {
+    cfg := SelectionSettings{Default: StrategyLRU}
+    _, err := s.settings.Get(ctx, selectionKey, &cfg)
+    return cfg, err
+}
+
+func (s *Selection) SetSettings(ctx context.Context, cfg SelectionSettings) error {
+    if err := cfg.Validate(); err != nil { return err }
+    return s.settings.Set(ctx, selectionKey, cfg)
+}
+
+// For returns the selector configured for wanIface, falling back to the global default.
+func (s *Selection) For(ctx context.Context, wanIface string) (Selector, error) {
+    cfg, err := s.Settings(ctx)
+    if err != nil { return nil, err }
+    name := cfg.PerIface[wanIface]
+    if name == "" { name = cfg.Default }
+    switch name {
+    case StrategyRoundRobin:
+        return &s.rr, nil
+    case StrategyWeightedRandom:
+        return WeightedRandom{}, nil
+    case StrategyPriority:
+        return Priority{Usernames: cfg.Priority}, nil
+    }
+    return LRU{}, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+// Session outcomes.
+const (
+    OutcomePending = "pending"
+    OutcomeSuccess = "success"
+    OutcomeFailed  = "failed"
+)
+
+// Session records one login attempt on a WAN interface and, if it succeeded, how long it lasted.
+type Session struct {
+    ID        int64
+    WanIface  string
+    Nic       string
+    AccountID int64
+    Username  string
+    StartedAt int64 // unix seconds
+    EndedAt   int64 // 0 while the attempt is running or the session is still up
+    Outcome   string
+    Error     string
+    ErrorKind string // login failure classification, see login.Kind
+    Weight    int
+    Output    string // login tool output
+}
+
+// Duration is the attempt or session length so far.
+func (x *Session) Duration() time.Duration {
+    end := x.EndedAt
+    if end == 0 { end = time.Now().Unix() }
+    return time.Duration(end-x.StartedAt) * time.Second
+}
+
+type SessionFilter struct {
+    WanIface  string
+    AccountID int64
+    Outcome   string
+    Since     int64 // started_at >= Since when non-zero
+    Until     int64 // started_at < Until when non-zero
+    Limit     int
+    Offset    int
+}
+
+type Sessions struct { db *sql.DB }
+
+func NewSessions(db *sql.DB) *Sessions { return &Sessions{db: db} }
+
+// Start opens a pending record for an attempt with the given account.
+func (s *Sessions) Start(ctx context.Context, wanIface, nic string, acct *models.Account) (int64, error) {
+    res, err := s.db.ExecContext(ctx, `INSERT INTO sessions (wan_iface, nic, account_id, username, started_at, outcome) VALUES (?, ?, ?, ?, ?, ?)`,
+        wanIface, nic, acct.ID, acct.Username, time.Now().Unix(), OutcomePending)
+    if err != nil { return 0, err }
+    return res.LastInsertId()
+}
+
+// Succeed marks the attempt successful; the session stays open until End or EndIface.
+func (s *Sessions) Succeed(ctx context.Context, id int64) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET outcome=? WHERE id=?`, OutcomeSuccess, id)
+    return err
+}
+
+// Fail closes the attempt with the given error text and classification.
+func (s *Sessions) Fail(ctx context.Context, id int64, kind, errText string) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET outcome=?, error_kind=?, error=?, ended_at=? WHERE id=?`, OutcomeFailed, kind, errText, time.Now().Unix(), id)
+    return err
+}
+
+// SetOutput stores what the login tool printed during the attempt.
+func (s *Sessions) SetOutput(ctx context.Context, id int64, output string) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET output=? WHERE id=?`, output, id)
+    return err
+}
+
+// Note stores an error that did not fail the attempt, e.g. a weight update that was rolled back.
+func (s *Sessions) Note(ctx context.Context, id int64, errText string) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET error=? WHERE id=?`, errText, id)
+    return err
+}
+
+func (s *Sessions) SetWeight(ctx context.Context, id int64, weight int) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET weight=? WHERE id=?`, weight, id)
+    return err
+}
+
+// EndIface ends every open successful session on wanIface, except the one with id keep.
+func (s *Sessions) EndIface(ctx context.Context, wanIface string, keep int64) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET ended_at=? WHERE wan_iface=? AND outcome=? AND ended_at=0 AND id<>?`,
+        time.Now().Unix(), wanIface, OutcomeSuccess, keep)
+    return err
+}
+
+// List returns the records matching f, newest first, together with the total match count.
+func (s *Sessions) List(ctx context.Context, f SessionFilter) ([]Session, int, error) {
+    var where []string
+    var args []any
+    if f.WanIface != "" { where = append(where, "wan_iface=?"); args = append(args, f.WanIface) }
+    if f.AccountID != 0 { where = append(where, "account_id=?"); args = append(args, f.AccountID) }
+    if f.Outcome != "" { where = append(where, "outcome=?"); args = append(args, f.Outcome) }
+    if f.Since != 0 { where = append(where, "started_at>=?"); args = append(args, f.Since) }
+    if f.Until != 0 { where = append(where, "started_at<?"); args = append(args, f.Until) }
+    cond := ""
+    if len(where) > 0 { cond = " WHERE " + strings.Join(where, " AND ") }
+
+    var total int
+    if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions`+cond, args...).Scan(&total); err != nil { return nil, 0, err }
+    if f.Limit <= 0 { f.Limit = 50 }
+    rows, err := s.db.QueryContext(ctx, `SELECT id, wan_iface, nic, account_id, username, started_at, ended_at, outcome, error, error_kind, weight, output
+        FROM sessions`+cond+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, f.Limit, f.Offset)...)
+    if err != nil { return nil, 0, err }
+    defer rows.Close()
+    var out []Session
+    for rows.Next() {
+        var x Session
+        if err := rows.Scan(&x.ID, &x.WanIface, &x.Nic, &x.AccountID, &x.Username, &x.StartedAt, &x.EndedAt, &x.Outcome, &x.Error, &x.ErrorKind, &x.Weight, &x.Output); err != nil { return nil, 0, err }
+        out = append(out, x)
+    }
+    return out, total, rows.Err()
+}
+
+// Reconcile fails attempts that were still pending when the process stopped.
+func (s *Sessions) Reconcile(ctx context.Context) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE sessions SET outcome=?, error='interrupted by restart', ended_at=? WHERE outcome=?`,
+        OutcomeFailed, time.Now().Unix(), OutcomePending)
+    return err
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+)
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// Settings stores JSON documents in the kv table.
+type Settings struct { db *sql.DB }
+
+func NewSettings(db *sql.DB) *Settings { return &Settings{db: db} }
+
+// Get decodes the value stored under key into v and reports whether it existed.
+func (s *Settings) Get(ctx context.Context, key string, v any) (bool, error) {
+    var raw string
+    err := s.db.QueryRowContext(ctx, `SELECT v FROM kv WHERE k=?`, key).Scan(&raw)
+    if errors.Is(err, sql.ErrNoRows) { return false, nil }
+    if err != nil { return false, err }
+    return true, json.Unmarshal([]byte(raw), v)
+}
+
+func (s *Settings) Set(ctx context.Context, key string, v any) error {
+    raw, err := json.Marshal(v)
+    if err != nil { return err }
+    _, err = s.db.ExecContext(ctx, `INSERT INTO kv (k, v) VALUES (?, ?) ON CONFLICT(k) DO UPDATE SET v=excluded.v`, key, string(raw))
+    return err
+}
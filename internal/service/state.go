@@ -0,0 +1,90 @@
+package service
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/Sleepstars/SZU-NetManager/internal/models"
+)
+
+var ErrInvalidTransition = errors.New("invalid account state transition")
+
+// stateTx wraps a transaction and collects the state changes made in it, so they can be
+// announced once the transaction has committed.
+type stateTx struct {
+    *sql.Tx
+    changes []models.StateChange
+}
+
+// set moves account id to state to, validating the move against the transition table.
+// An account that is disabled lands in DISABLED rather than IDLE.
+func (st *stateTx) set(ctx context.Context, id int64, to models.AccountState) error {
+    var username string
+    var from models.AccountState
+    var disabled int
+    err := st.QueryRowContext(ctx, `SELECT username, status, disabled FROM accounts WHERE id=?`, id).Scan(&username, &from, &disabled)
+    if errors.Is(err, sql.ErrNoRows) { return ErrNotFound }
+    if err != nil { return err }
+    if to == models.StateIdle && disabled != 0 { to = models.StateDisabled }
+    if from == to { return nil }
+    if !from.CanTransition(to) { return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to) }
+    if _, err := st.ExecContext(ctx, `UPDATE accounts SET status=? WHERE id=?`, to, id); err != nil { return err }
+    st.changes = append(st.changes, models.StateChange{AccountID: id, Username: username, From: from, To: to})
+    return nil
+}
+
+// withStates runs fn in a transaction and announces its state changes after commit.
+func (a *Accounts) withStates(ctx context.Context, fn func(st *stateTx) error) error {
+    tx, err := a.db.BeginTx(ctx, nil)
+    if err != nil { return err }
+    defer tx.Rollback()
+    st := &stateTx{Tx: tx}
+    if err := fn(st); err != nil { return err }
+    if err := tx.Commit(); err != nil { return err }
+    if a.OnStateChange != nil {
+        for _, c := range st.changes { a.OnStateChange(c) }
+    }
+    return nil
+}
+
+// Transition moves an account to a new state; moves not allowed by the transition table fail
+// with ErrInvalidTransition.
+func (a *Accounts) Transition(ctx context.Context, id int64, to models.AccountState) error {
+    return a.withStates(ctx, func(st *stateTx) error { return st.set(ctx, id, to) })
+}
+
+// Reconcile repairs states left behind by an unclean shutdown: CONNECTING accounts lose their
+// lease and return to IDLE, and ONLINE accounts without an active lease return to IDLE.
+func (a *Accounts) Reconcile(ctx context.Context) (int, error) {
+    n := 0
+    err := a.withStates(ctx, func(st *stateTx) error {
+        now := time.Now().Unix()
+        if _, err := st.ExecContext(ctx, `DELETE FROM account_leases WHERE expires_at <= ?
+            OR account_id IN (SELECT id FROM accounts WHERE status='CONNECTING')`, now); err != nil { return err }
+        rows, err := st.QueryContext(ctx, `SELECT id FROM accounts WHERE status='CONNECTING'
+            OR (status='ONLINE' AND id NOT IN (SELECT account_id FROM account_leases))`)
+        if err != nil { return err }
+        ids, err := scanIDs(rows)
+        if err != nil { return err }
+        for _, id := range ids {
+            if err := st.set(ctx, id, models.StateIdle); err != nil { return err }
+        }
+        n = len(ids)
+        return nil
+    })
+    return n, err
+}
+
+func scanIDs(rows *sql.Rows) ([]int64, error) {
+    defer rows.Close()
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
@@ -2,10 +2,12 @@ package sshqueue
 
 import (
     "bytes"
+    "context"
     "fmt"
     "golang.org/x/crypto/ssh"
     "io"
     "os"
+    "strings"
     "sync"
 )
 
@@ -46,3 +48,36 @@ func (q *Queue) Exec(cmd string) (string, error) {
     io.Copy(io.Discard, &stderr)
     return stdout.String(), nil
 }
+
+// ExecInput runs cmd with stdin attached, writing stdout and stderr to out as they arrive.
+// It is serialized with Exec; cancelling ctx closes the connection and ends the command.
+func (q *Queue) ExecInput(ctx context.Context, cmd string, stdin io.Reader, out io.Writer) error {
+    q.mu.Lock(); defer q.mu.Unlock()
+    client, err := ssh.Dial("tcp", q.addr, q.conf)
+    if err != nil { return fmt.Errorf("ssh dial: %w", err) }
+    defer client.Close()
+    sess, err := client.NewSession()
+    if err != nil { return fmt.Errorf("ssh session: %w", err) }
+    defer sess.Close()
+    sess.Stdin = stdin
+    sess.Stdout = out
+    sess.Stderr = out
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        select {
+        case <-ctx.Done():
+            _ = sess.Signal(ssh.SIGKILL)
+            _ = client.Close()
+        case <-done:
+        }
+    }()
+    if err := sess.Run(cmd); err != nil {
+        if ctx.Err() != nil { return ctx.Err() }
+        return fmt.Errorf("run: %w", err)
+    }
+    return nil
+}
+
+// Quote quotes s for a POSIX shell.
+func Quote(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
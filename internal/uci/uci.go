@@ -1,6 +1,7 @@
 package uci
 
 import (
+    "encoding/json"
     "fmt"
     "regexp"
     "strings"
@@ -54,3 +55,20 @@ func (c *Client) Rollback(backupPath string) error {
     return err
 }
 
+
+var ifaceName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// InterfaceIP returns the first IPv4 address netifd reports for iface (`ifstatus <iface>`).
+func (c *Client) InterfaceIP(iface string) (string, error) {
+    if !ifaceName.MatchString(iface) { return "", fmt.Errorf("invalid interface name %q", iface) }
+    out, err := c.q.Exec("ifstatus " + iface)
+    if err != nil { return "", err }
+    var st struct {
+        Addr []struct {
+            Address string `json:"address"`
+        } `json:"ipv4-address"`
+    }
+    if err := json.Unmarshal([]byte(out), &st); err != nil { return "", fmt.Errorf("parse ifstatus %s: %w", iface, err) }
+    if len(st.Addr) == 0 { return "", fmt.Errorf("interface %s has no IPv4 address", iface) }
+    return st.Addr[0].Address, nil
+}
@@ -192,7 +192,7 @@ function Wizard() {
 
   const onSave = async () => {
     try {
-      await Promise.all(Object.entries(mapping).map(([wan, nic]) => postJSON("/api/iface-map", { WanIface: wan, Nic: nic })))
+      await Promise.all(Object.entries(mapping).map(([wan, nic]) => postJSON("/api/iface-map", { wan_iface: wan, nic: nic })))
       message.success('已保存接口映射')
     } catch (e: any) { message.error(e.message) }
   }
@@ -276,7 +276,7 @@ function Accounts() {
   const onAdd = async () => {
     try {
       const v = await form.validateFields()
-      await postJSON("/api/accounts", { Username: v.username, Password: v.password, Bandwidth: Number(v.bandwidth) })
+      await postJSON("/api/accounts", { username: v.username, password: v.password, bandwidth: Number(v.bandwidth) })
       form.resetFields()
       message.success('账号添加成功')
       load()